@@ -2,23 +2,26 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/prometheus/alertmanager/api/v2/models"
 	"github.com/prometheus/common/version"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"github.com/trustyou/kured-alert-silencer/pkg/controller"
 	"github.com/trustyou/kured-alert-silencer/pkg/kured"
 	"github.com/trustyou/kured-alert-silencer/pkg/silence"
+	"github.com/trustyou/kured-alert-silencer/pkg/webhook"
 
-	v1 "k8s.io/api/apps/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/fields"
-	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
@@ -28,11 +31,53 @@ var (
 	dsName              string
 	dsNamespace         string
 	lockAnnotation      string
+	lockSourceType      string
+	leaseNamespace      string
+	leaseName           string
 	logFormat           string
 	logLevel            string
 	alertmanagerURL     string
+	alertmanagerTimeout string
+	targetsJSON         string
 	silenceDuration     string
+	silenceLagTime      string
 	silenceMatchersJSON string
+	silenceCreatedBy    string
+	silenceComment      string
+	silenceCanaries     string
+	exclusions          string
+	silenceExclusions   string
+	preRebootExclusions string
+	podExclusions       string
+	clusterName         string
+	watchNodes          bool
+	rebootInProgress    string
+	preRebootNodeKey    string
+	preRebootMetricsURL string
+	preRebootPoll       string
+	preRebootDuration   string
+	preRebootMatchers   string
+	preRebootComment    string
+	podSilenceMode      string
+	podMatchersJSON     string
+	cleanupOnStartup    bool
+	cleanupOnShutdown   bool
+	shutdownTimeout     string
+	retryBaseDelay      string
+	retryMaxDelay       string
+	webhookURL          string
+	webhookBody         string
+	webhookSecretFile   string
+	webhookTimeout      string
+	webhookRetries      int
+	maxSilencedNodes    string
+	metricsAddress      string
+	minSilenceDuration  string
+	rebootDays          string
+	startTime           string
+	endTime             string
+	timeZone            string
+	maxSilenceDuration  string
 	showVersion         bool
 )
 
@@ -76,6 +121,20 @@ func bindViper(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// setupLogging applies the log level and format flags
+func setupLogging() error {
+	level, err := log.ParseLevel(logLevel)
+	if err != nil {
+		return err
+	}
+	log.SetLevel(level)
+
+	if logFormat == "json" {
+		log.SetFormatter(&log.JSONFormatter{})
+	}
+	return nil
+}
+
 // NewRootCommand construct the Cobra root command
 func NewRootCommand() *cobra.Command {
 	rootCmd := &cobra.Command{
@@ -91,23 +150,175 @@ func NewRootCommand() *cobra.Command {
 		"name of daemonset on which to place lock")
 	rootCmd.PersistentFlags().StringVar(&lockAnnotation, "lock-annotation", KuredNodeLockAnnotation,
 		"annotation in which to record locking node")
+	rootCmd.PersistentFlags().StringVar(&lockSourceType, "lock-source", kured.LockSourceDaemonSet,
+		"object on which Kured place the lock: daemonset or lease")
+	rootCmd.PersistentFlags().StringVar(&leaseNamespace, "lease-namespace", "kube-system",
+		"namespace containing the lease on which Kured place the lock")
+	rootCmd.PersistentFlags().StringVar(&leaseName, "lease-name", "kured",
+		"name of the lease on which Kured place the lock")
 	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text",
 		"use text or json log format")
 	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info",
 		"debug, info, warn, error, fatal, or panic")
 	rootCmd.PersistentFlags().StringVar(&alertmanagerURL, "alertmanager-url", "http://localhost:9093",
 		"Alertmanager URL to silence alerts")
+	rootCmd.PersistentFlags().StringVar(&alertmanagerTimeout, "alertmanager-timeout", silence.DefaultRequestTimeout.String(),
+		"timeout of each Alertmanager API request in Go duration format")
+	rootCmd.PersistentFlags().StringVar(&targetsJSON, "targets-json", "",
+		`JSON string with the silence targets, replacing --alertmanager-url, with format [{"name": "grafana", "type": "grafana", "url": "https://grafana.example.com", "bearerTokenFile": "/etc/grafana/token"}] `+
+			`where type is alertmanager, grafana or mimir and credentials are either bearerTokenFile or username and passwordFile, `+
+			`or pagerduty with apiKeyFile, from and serviceIDs, or opsgenie with apiKeyFile and integrationIDs creating maintenance windows, `+
+			`and an optional tenant sent as X-Scope-OrgID, a Go template with access to the node labels, e.g. {{index .NodeLabels "example.com/tenant"}}`)
 	rootCmd.PersistentFlags().StringVar(&silenceDuration, "silence-duration", "10m",
-		"Silence duration for alerts in Go duration format (e.g. 10m, 1h, 2h30m)")
+		"Silence duration for alerts in Go duration format (e.g. 10m, 1h, 2h30m), capped by the kured lock TTL when set")
+	rootCmd.PersistentFlags().StringVar(&silenceLagTime, "silence-lag-time", "0s",
+		"Keep silences active this long after the kured lock is released, in Go duration format")
 	rootCmd.PersistentFlags().StringVar(
 		&silenceMatchersJSON,
 		"silence-matchers-json",
 		`[{"name": "instance", "value": "{{.NodeName}}", "isRegex": false}]`,
-		`JSON string with format [{"name": "instance", "value": "{{.NodeName}}", "isRegex": false}, {"name": "alertname", "value": "node_reboot", "isRegex": false}]`)
+		`JSON string with format [{"matchers": [{"name": "instance", "value": "{{.NodeName}}", "isRegex": false}, {"name": "alertname", "value": "node_reboot", "isRegex": false}]}] `+
+			`creating one silence per group of matchers, or [{"name": "instance", "value": "{{.NodeName}}", "isRegex": false}] creating one silence per matcher. `+
+			`Every silence needs a matcher on the node, a silence of a flat list matching another label only is refused. Each group optionally carries its own "duration" replacing --silence-duration and "delay" shifting the silence, e.g. {"matchers": [...], "duration": "30m", "delay": "5m"}. `+
+			`A group "duration" ends the silence from the start of the lock, so it is not extended by --silence-lag-time when the lock is released`)
+	rootCmd.PersistentFlags().StringVar(&silenceCreatedBy, "silence-created-by", silence.DefaultCreatedBy,
+		"createdBy value set on every silence")
+	rootCmd.PersistentFlags().StringVar(&silenceComment, "silence-comment-template", silence.DefaultCommentTemplate,
+		"Go template for the silence comment, with access to {{.NodeName}}, {{.ClusterName}}, {{.SilencerPod}}, {{.LockCreated}}, {{.LockMetadata}} and {{.Unschedulable}}")
+	rootCmd.PersistentFlags().StringVar(&silenceCanaries, "silence-canary-values", "",
+		"comma-separated label values of unrelated alerts, e.g. prometheus-0,alertmanager-0, that no regex matcher may match, refusing the silence otherwise")
+	rootCmd.PersistentFlags().StringVar(&exclusions, "exclusion-matchers", "",
+		`negative matchers in the Alertmanager syntax appended to every silence, e.g. {severity!="critical", alertname!="Watchdog"}, so that the excluded alerts still fire. Refused with pagerduty or opsgenie targets, whose maintenance windows mute every alert`)
+	rootCmd.PersistentFlags().StringVar(&silenceExclusions, "silence-exclusion-matchers", "",
+		"exclusion matchers appended to the node silences only, in the same format as --exclusion-matchers. Refused with pagerduty or opsgenie targets, whose maintenance windows mute every alert")
+	rootCmd.PersistentFlags().StringVar(&clusterName, "cluster-name", "",
+		"cluster name exposed to templates as {{.ClusterName}}")
+	rootCmd.PersistentFlags().BoolVar(&watchNodes, "watch-nodes", false,
+		"also silence nodes cordoned or NotReady while Kured reboots them, as a fallback when the lock is missed")
+	rootCmd.PersistentFlags().StringVar(&rebootInProgress, "reboot-in-progress-annotation", kured.KuredRebootInProgressAnnotation,
+		"node annotation set by Kured while rebooting a node (requires Kured --annotate-nodes)")
+	rootCmd.PersistentFlags().StringVar(&preRebootNodeKey, "pre-reboot-node-key", "",
+		"node label or annotation marking nodes requiring a reboot, enables pending reboot silences when set")
+	rootCmd.PersistentFlags().StringVar(&preRebootMetricsURL, "pre-reboot-metrics-url", "",
+		"URL exposing the Kured kured_reboot_required metric of the nodes, enables pending reboot silences when set")
+	rootCmd.PersistentFlags().StringVar(&preRebootPoll, "pre-reboot-poll-interval", "1m",
+		"interval between two reads of --pre-reboot-metrics-url in Go duration format")
+	rootCmd.PersistentFlags().StringVar(&preRebootDuration, "pre-reboot-silence-duration", "30m",
+		"Silence duration for pending reboot alerts in Go duration format, measured from the first time the reboot is required")
+	rootCmd.PersistentFlags().StringVar(
+		&preRebootMatchers,
+		"pre-reboot-matchers-json",
+		`[{"matchers": [{"name": "alertname", "value": "RebootRequired", "isRegex": false}, {"name": "instance", "value": "{{.NodeName}}", "isRegex": false}]}]`,
+		"JSON string with the pending reboot silence matchers, in the same format as --silence-matchers-json")
+	rootCmd.PersistentFlags().StringVar(&preRebootComment, "pre-reboot-comment-template", "Silencing pending node reboot: {{.NodeName}}",
+		"Go template for the pending reboot silence comment")
+	rootCmd.PersistentFlags().StringVar(&preRebootExclusions, "pre-reboot-exclusion-matchers", "",
+		"exclusion matchers appended to the pending reboot silences only, in the same format as --exclusion-matchers")
+	rootCmd.PersistentFlags().StringVar(&podSilenceMode, "pod-silence-mode", "",
+		"also silence the pods running on the node at lock time, per pod or per workload (pod or workload)")
+	rootCmd.PersistentFlags().StringVar(&podMatchersJSON, "pod-matchers-json", "",
+		"JSON string with the pod silence matchers, with access to {{.Namespace}}, {{.Pod}}, {{.WorkloadKind}}, {{.WorkloadName}}, quoted in regex matchers with {{quoteRegex .WorkloadName}}, {{.WorkloadLabel}}, the kube-state-metrics label of the workload, e.g. job_name, and {{.PodNameSuffix}}, the regex of the generated part of its pod names (default depends on --pod-silence-mode)")
+	rootCmd.PersistentFlags().StringVar(&podExclusions, "pod-exclusion-matchers", "",
+		"exclusion matchers appended to the pod silences only, in the same format as --exclusion-matchers")
+	rootCmd.PersistentFlags().BoolVar(&cleanupOnStartup, "cleanup-on-startup", false,
+		"expire silences created by --silence-created-by that no longer correspond to an active reboot of this cluster on startup. "+
+			"Set --silence-created-by to a value unique to the cluster first when several clusters share the Alertmanager, their silences are expired otherwise")
+	rootCmd.PersistentFlags().BoolVar(&cleanupOnShutdown, "cleanup-on-shutdown", false,
+		"expire silences created by --silence-created-by that no longer correspond to an active reboot of this cluster on shutdown, see --cleanup-on-startup")
+	rootCmd.PersistentFlags().StringVar(&shutdownTimeout, "shutdown-timeout", "30s",
+		"time given to the shutdown on SIGINT or SIGTERM, shared by the in-flight silences, the shutdown cleanup and the webhook events, "+
+			"in Go duration format. Keep it below the terminationGracePeriodSeconds of the pod")
+	rootCmd.PersistentFlags().StringVar(&retryBaseDelay, "retry-base-delay", controller.DefaultRetryBaseDelay.String(),
+		"delay before retrying silences failing on target errors, e.g. network or server errors, in Go duration format, doubled after each failure")
+	rootCmd.PersistentFlags().StringVar(&retryMaxDelay, "retry-max-delay", controller.DefaultRetryMaxDelay.String(),
+		"maximum delay between two retries of a failing silence in Go duration format")
+	rootCmd.PersistentFlags().StringVar(&webhookURL, "webhook-url", "",
+		"URL receiving a POST when silences are created, extended, expired or fail, disabled when empty")
+	rootCmd.PersistentFlags().StringVar(&webhookBody, "webhook-body-template", "",
+		`Go template of the webhook body with access to {{.Event}}, {{.Cluster}}, {{.Target}}, {{.Node}}, {{.Matchers}}, {{.StartsAt}}, {{.EndsAt}}, {{.SilenceIDs}} and {{.Error}}, `+
+			`and a json function encoding values, e.g. {"text": {{printf "%s silences for %s" .Event .Node | json}}} (default is the JSON event)`)
+	rootCmd.PersistentFlags().StringVar(&webhookSecretFile, "webhook-secret-file", "",
+		"file holding the HMAC-SHA256 key signing the webhook body in the X-Signature-256 header")
+	rootCmd.PersistentFlags().StringVar(&webhookTimeout, "webhook-timeout", webhook.DefaultTimeout.String(),
+		"timeout of each webhook request in Go duration format")
+	rootCmd.PersistentFlags().IntVar(&webhookRetries, "webhook-retries", webhook.DefaultRetries,
+		"number of retries of a failing webhook request, with exponential backoff")
+	rootCmd.PersistentFlags().StringVar(&maxSilencedNodes, "max-silenced-nodes", "",
+		"maximum number of nodes silenced simultaneously, counting the lock holders and the nodes in their release lag, absolute (e.g. 5) or as a percentage of the Nodes (e.g. 10%), beyond which silences are refused (default unlimited)")
+	rootCmd.PersistentFlags().StringVar(&metricsAddress, "metrics-address", "",
+		"address serving the Prometheus metrics on /metrics, e.g. :8080, disabled when empty")
+	rootCmd.PersistentFlags().StringVar(&rebootDays, "reboot-days", controller.DefaultScheduleDays,
+		"days of the maintenance schedule, like kured --reboot-days, reboots started outside of the schedule are not silenced")
+	rootCmd.PersistentFlags().StringVar(&startTime, "start-time", controller.DefaultScheduleStartTime,
+		"start time of the maintenance schedule, like kured --start-time")
+	rootCmd.PersistentFlags().StringVar(&endTime, "end-time", controller.DefaultScheduleEndTime,
+		"end time of the maintenance schedule, like kured --end-time")
+	rootCmd.PersistentFlags().StringVar(&timeZone, "time-zone", "UTC",
+		"time zone of the maintenance schedule, like kured --time-zone")
+	rootCmd.PersistentFlags().StringVar(&minSilenceDuration, "min-silence-duration", controller.DefaultMinSilenceDuration.String(),
+		"shortest silence duration accepted at startup in Go duration format")
+	rootCmd.PersistentFlags().StringVar(&maxSilenceDuration, "max-silence-duration", controller.DefaultMaxSilenceDuration.String(),
+		"longest silence window accepted at startup, lag time included, in Go duration format")
 	rootCmd.PersistentFlags().BoolVar(&showVersion, "version", false, "Show version and exit")
+	rootCmd.AddCommand(newSilenceCommand())
+	rootCmd.AddCommand(newStatusCommand())
 	return rootCmd
 }
 
+// parseCanaryValues splits the comma-separated canary label values
+func parseCanaryValues(value string) []string {
+	canaryValues := []string{}
+	for _, canaryValue := range strings.Split(value, ",") {
+		if canaryValue = strings.TrimSpace(canaryValue); canaryValue != "" {
+			canaryValues = append(canaryValues, canaryValue)
+		}
+	}
+	return canaryValues
+}
+
+// parseExclusionFlags returns the exclusion matchers of the node, pending reboot and pod silences, the global
+// exclusions being merged into the exclusions of each kind of silence
+func parseExclusionFlags() ([]*models.Matcher, []*models.Matcher, []*models.Matcher, error) {
+	errs := []error{}
+	parseExclusions := func(flag string, value string) []*models.Matcher {
+		parsed, err := silence.ParseExclusions(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("--%s: %w", flag, err))
+		}
+		return parsed
+	}
+	globalExclusions := parseExclusions("exclusion-matchers", exclusions)
+	return silence.MergeExclusions(globalExclusions, parseExclusions("silence-exclusion-matchers", silenceExclusions)),
+		silence.MergeExclusions(globalExclusions, parseExclusions("pre-reboot-exclusion-matchers", preRebootExclusions)),
+		silence.MergeExclusions(globalExclusions, parseExclusions("pod-exclusion-matchers", podExclusions)),
+		errors.Join(errs...)
+}
+
+// newTargets initializes the silencer of each target of --targets-json, or of the --alertmanager-url Alertmanager
+func newTargets(timeout time.Duration) ([]controller.Target, error) {
+	silenceTargets := []silence.Target{{Name: "alertmanager", Type: silence.TargetTypeAlertmanager, URL: alertmanagerURL}}
+	if targetsJSON != "" {
+		var err error
+		silenceTargets, err = silence.ParseTargets(targetsJSON)
+		if err != nil {
+			return nil, fmt.Errorf("--targets-json: %w", err)
+		}
+	}
+
+	errs := []error{}
+	targets := []controller.Target{}
+	for _, target := range silenceTargets {
+		silencer, err := silence.NewTargetSilencer(target, timeout)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to initialize %s client for target %s: %w", target.Type, target.Name, err))
+			continue
+		}
+		log.Infof("target %s: %s %s", target.Name, target.Type, target.URL)
+		targets = append(targets, controller.Target{Name: target.Name, Silencer: silencer, Tenant: target.Tenant, Maintenance: target.Maintenance()})
+	}
+	return targets, errors.Join(errs...)
+}
+
 func main() {
 	cmd := NewRootCommand()
 
@@ -122,19 +333,15 @@ func root(cmd *cobra.Command, args []string) {
 		os.Exit(0)
 	}
 
-	level, err := log.ParseLevel(logLevel)
-	if err != nil {
+	if err := setupLogging(); err != nil {
 		log.Fatal(err)
 	}
-	log.SetLevel(level)
-
-	if logFormat == "json" {
-		log.SetFormatter(&log.JSONFormatter{})
-	}
 
 	log.Info("Kured Alert Silencer starting")
 
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	config, err := rest.InClusterConfig()
 	if err != nil {
 		log.Fatal(err)
@@ -148,58 +355,244 @@ func root(cmd *cobra.Command, args []string) {
 	log.Infof("Kured daemon set namespace: %s", dsNamespace)
 	log.Infof("Kured daemon set name: %s", dsName)
 	log.Infof("Alertmanager URL: %s", alertmanagerURL)
+	log.Infof("Alertmanager timeout: %s", alertmanagerTimeout)
+	log.Infof("targets JSON: %s", targetsJSON)
 	log.Infof("lock annotation: %s", lockAnnotation)
+	log.Infof("lock source: %s", lockSourceType)
 	log.Infof("silence duration: %s", silenceDuration)
+	log.Infof("silence lag time: %s", silenceLagTime)
 	log.Infof("silence matchers JSON: %s", silenceMatchersJSON)
+	log.Infof("silence created by: %s", silenceCreatedBy)
+	log.Infof("silence comment template: %s", silenceComment)
+	log.Infof("silence canary values: %s", silenceCanaries)
+	log.Infof("exclusion matchers: %s", exclusions)
+	log.Infof("silence exclusion matchers: %s", silenceExclusions)
+	log.Infof("pre-reboot exclusion matchers: %s", preRebootExclusions)
+	log.Infof("pod exclusion matchers: %s", podExclusions)
+	log.Infof("cluster name: %s", clusterName)
+	log.Infof("watch nodes: %t", watchNodes)
+	log.Infof("pre-reboot node key: %s", preRebootNodeKey)
+	log.Infof("pre-reboot metrics URL: %s", preRebootMetricsURL)
+	log.Infof("pod silence mode: %s", podSilenceMode)
+	log.Infof("cleanup on startup: %t", cleanupOnStartup)
+	log.Infof("cleanup on shutdown: %t", cleanupOnShutdown)
+	log.Infof("shutdown timeout: %s", shutdownTimeout)
+	log.Infof("retry base delay: %s", retryBaseDelay)
+	log.Infof("retry max delay: %s", retryMaxDelay)
+	log.Infof("webhook URL: %s", webhookURL)
+	log.Infof("webhook body template: %s", webhookBody)
+	log.Infof("webhook timeout: %s", webhookTimeout)
+	log.Infof("webhook retries: %d", webhookRetries)
+	log.Infof("max silenced nodes: %s", maxSilencedNodes)
+	log.Infof("metrics address: %s", metricsAddress)
+	log.Infof("reboot days: %s", rebootDays)
+	log.Infof("start time: %s", startTime)
+	log.Infof("end time: %s", endTime)
+	log.Infof("time zone: %s", timeZone)
+	log.Infof("min silence duration: %s", minSilenceDuration)
+	log.Infof("max silence duration: %s", maxSilenceDuration)
+
+	// every configuration problem is collected to be reported at once
+	errs := []error{}
+	parseDuration := func(flag string, value string) time.Duration {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("--%s: %w", flag, err))
+		}
+		return duration
+	}
+
+	silenceDurationtime := parseDuration("silence-duration", silenceDuration)
+	silenceLagTimeDuration := parseDuration("silence-lag-time", silenceLagTime)
+
+	silenceWindow := kured.SilenceWindow{
+		Duration: silenceDurationtime,
+		Lag:      silenceLagTimeDuration,
+	}
+
+	preRebootPollInterval := parseDuration("pre-reboot-poll-interval", preRebootPoll)
+	preRebootSilenceDuration := parseDuration("pre-reboot-silence-duration", preRebootDuration)
+	alertmanagerTimeoutDuration := parseDuration("alertmanager-timeout", alertmanagerTimeout)
+	shutdownTimeoutDuration := parseDuration("shutdown-timeout", shutdownTimeout)
+	retryBaseDelayDuration := parseDuration("retry-base-delay", retryBaseDelay)
+	retryMaxDelayDuration := parseDuration("retry-max-delay", retryMaxDelay)
+	webhookTimeoutDuration := parseDuration("webhook-timeout", webhookTimeout)
+	minSilenceDurationValue := parseDuration("min-silence-duration", minSilenceDuration)
+	maxSilenceDurationValue := parseDuration("max-silence-duration", maxSilenceDuration)
+
+	// the default schedule covers every time, reboots are then silenced without checking it
+	var schedule *controller.Schedule
+	if rebootDays != controller.DefaultScheduleDays || startTime != controller.DefaultScheduleStartTime || endTime != controller.DefaultScheduleEndTime {
+		schedule, err = controller.ParseSchedule(rebootDays, startTime, endTime, timeZone)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("schedule: %w", err))
+		}
+	}
 
-	silenceDurationtime, err := time.ParseDuration(silenceDuration)
+	guard, err := controller.ParseMaxSilencedNodes(maxSilencedNodes)
 	if err != nil {
-		log.Fatal(err)
+		errs = append(errs, fmt.Errorf("--max-silenced-nodes: %w", err))
+	}
+
+	if podMatchersJSON == "" {
+		switch podSilenceMode {
+		case controller.PodSilenceModePod:
+			podMatchersJSON = controller.DefaultPodMatchersJSON
+		case controller.PodSilenceModeWorkload:
+			podMatchersJSON = controller.DefaultWorkloadMatchersJSON
+		}
 	}
+	log.Infof("pod matchers JSON: %s", podMatchersJSON)
 
 	nowProvider := func() time.Time {
 		return time.Now()
 	}
 
-	for {
-		log.Info("watching DaemonSet")
+	silencerPod, err := os.Hostname()
+	if err != nil {
+		log.WithError(err).Warn("failed to get silencer pod name")
+	}
 
-		watcher, err := client.AppsV1().DaemonSets(dsNamespace).Watch(ctx, metav1.ListOptions{
-			FieldSelector: fields.OneTermEqualSelector("metadata.name", dsName).String(),
+	nodeExclusions, preRebootExclusionMatchers, podExclusionMatchers, err := parseExclusionFlags()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	canaryValues := parseCanaryValues(silenceCanaries)
+
+	silenceConfig := silence.Config{
+		MatchersJSON:    silenceMatchersJSON,
+		CreatedBy:       silenceCreatedBy,
+		CommentTemplate: silenceComment,
+		CanaryValues:    canaryValues,
+		Exclusions:      nodeExclusions,
+	}
+
+	var lockSource kured.LockSource
+	switch lockSourceType {
+	case kured.LockSourceDaemonSet:
+		lockSource = kured.NewDaemonSetLockSource(client, dsNamespace, dsName, lockAnnotation)
+	case kured.LockSourceLease:
+		lockSource = kured.NewLeaseLockSource(client, leaseNamespace, leaseName)
+	default:
+		errs = append(errs, fmt.Errorf("--lock-source: unknown lock source: %s", lockSourceType))
+	}
+
+	targets, err := newTargets(alertmanagerTimeoutDuration)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	var notifier controller.Notifier
+	var sink *webhook.Sink
+	if webhookURL != "" {
+		sink, err = webhook.New(webhook.Config{
+			URL:          webhookURL,
+			BodyTemplate: webhookBody,
+			SecretFile:   webhookSecretFile,
+			Timeout:      webhookTimeoutDuration,
+			Retries:      webhookRetries,
 		})
 		if err != nil {
-			log.WithError(err).Error("failed to create DaemonSet watcher, retrying...")
-			time.Sleep(5 * time.Second)
-			continue
+			errs = append(errs, fmt.Errorf("failed to initialize webhook: %w", err))
+		} else {
+			notifier = sink
 		}
+	}
 
-		alertmanager, err := silence.NewAlertmanagerClient(alertmanagerURL)
-		if err != nil {
-			log.WithError(err).Fatal("failed to initialize Alertmanager client")
-		}
+	controllerConfig := controller.Config{
+		LockSource: lockSource,
+		Targets:    targets,
+		Silence:    silenceConfig,
+		TemplateData: silence.TemplateData{
+			ClusterName: clusterName,
+			SilencerPod: silencerPod,
+		},
+		Window:                     silenceWindow,
+		NowProvider:                nowProvider,
+		DetectRebootingNodes:       watchNodes,
+		RebootInProgressAnnotation: rebootInProgress,
+		PreReboot: controller.PreRebootConfig{
+			Silence: silence.Config{
+				MatchersJSON:    preRebootMatchers,
+				CreatedBy:       silenceCreatedBy,
+				CommentTemplate: preRebootComment,
+				CanaryValues:    canaryValues,
+				Exclusions:      preRebootExclusionMatchers,
+			},
+			Duration:     preRebootSilenceDuration,
+			NodeKey:      preRebootNodeKey,
+			MetricsURL:   preRebootMetricsURL,
+			PollInterval: preRebootPollInterval,
+		},
+		Pods: controller.PodSilenceConfig{
+			Mode:         podSilenceMode,
+			MatchersJSON: podMatchersJSON,
+			Exclusions:   podExclusionMatchers,
+		},
+		Retry: controller.RetryConfig{
+			BaseDelay: retryBaseDelayDuration,
+			MaxDelay:  retryMaxDelayDuration,
+		},
+		ShutdownTimeout: shutdownTimeoutDuration,
+		Guard:           guard,
+		Schedule:        schedule,
+		Notifier:        notifier,
+	}
+	if err := controllerConfig.Validate(minSilenceDurationValue, maxSilenceDurationValue); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		log.Fatalf("invalid configuration:\n%s", errors.Join(errs...))
+	}
 
-		for event := range watcher.ResultChan() {
-			switch event.Type {
-			case watch.Added, watch.Modified:
-				ds := event.Object.(*v1.DaemonSet)
-				silencerArray, err := kured.ExtractNodeIDsFromAnnotation(ds, lockAnnotation, silenceDurationtime, nowProvider)
-				if err != nil {
-					log.WithError(err).Error("failed to extract node IDs from DaemonSet annotation")
-					continue
-				}
-
-				for _, silenceNode := range silencerArray {
-					log.Infof("silencing alerts for node %s", silenceNode.NodeID)
-					err = silence.SilenceAlerts(alertmanager, silenceMatchersJSON, silenceNode.NodeID, silenceNode.SilenceEnd)
-					if err != nil {
-						log.WithError(err).Errorf("failed to silence alerts for node %s", silenceNode.NodeID)
-					}
-				}
-			case watch.Deleted:
-				log.Info("daemonSet deleted")
-			case watch.Error:
-				log.WithError(err).Error("error watching DaemonSet, restarting watch...")
+	silenceController := controller.New(client, controllerConfig)
+
+	if metricsAddress != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", silenceController.MetricsHandler())
+		metricsServer := &http.Server{Addr: metricsAddress, Handler: mux}
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.WithError(err).Error("failed to serve metrics")
 			}
+		}()
+		defer metricsServer.Close()
+	}
+
+	if (cleanupOnStartup || cleanupOnShutdown) && silenceCreatedBy == silence.DefaultCreatedBy {
+		log.Warnf("the cleanup expires the silences created by %s of every cluster sharing the targets, set --silence-created-by to a value unique to this cluster", silence.DefaultCreatedBy)
+	}
+
+	if cleanupOnStartup {
+		if err := silenceController.CleanupOrphanedSilences(ctx); err != nil {
+			log.WithError(err).Error("failed to cleanup orphaned silences")
 		}
 	}
+
+	// the shutdown steps share a single deadline, the shutdown timeout after the signal, so that they end within the
+	// grace period of the pod
+	shutdownCtx, cancelShutdown := context.WithCancel(context.Background())
+	defer cancelShutdown()
+	context.AfterFunc(ctx, func() {
+		time.AfterFunc(shutdownTimeoutDuration, cancelShutdown)
+	})
+
+	if err := silenceController.Run(ctx); err != nil {
+		log.WithError(err).Error("failed to stop gracefully")
+	}
+
+	if cleanupOnShutdown {
+		log.Info("cleaning up orphaned silences")
+		if err := silenceController.CleanupOrphanedSilences(shutdownCtx); err != nil {
+			log.WithError(err).Error("failed to cleanup orphaned silences")
+		}
+	}
+
+	if sink != nil {
+		if err := sink.Close(shutdownCtx); err != nil {
+			log.WithError(err).Error("failed to send the webhook events")
+		}
+	}
+
+	log.Info("Kured Alert Silencer stopped")
 }
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/trustyou/kured-alert-silencer/pkg/controller"
+	"github.com/trustyou/kured-alert-silencer/pkg/silence"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+var (
+	// silence command flags
+	silenceNodes    []string
+	silenceFor      string
+	outputFormat    string
+	manualCreatedBy string
+)
+
+// newSilenceCommand constructs the silence command, creating, listing and expiring the silences of nodes outside of
+// kured reboots, e.g. for a manual drain, with the configured templates and targets
+func newSilenceCommand() *cobra.Command {
+	silenceCmd := &cobra.Command{
+		Use:           "silence",
+		Short:         "Create, list or expire the silences of nodes, e.g. for a manual maintenance. Creates them without subcommand",
+		Example:       "kured-alert-silencer silence --node worker-1 --duration 30m",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		// replaces the root one, which only binds the environment variables
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := bindViper(cmd, args); err != nil {
+				return err
+			}
+			return setupLogging()
+		},
+		RunE: runSilenceCreate,
+	}
+	silenceCmd.PersistentFlags().StringSliceVar(&silenceNodes, "node", nil,
+		"node whose silences are created, listed or expired, repeatable or comma-separated")
+	silenceCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputTable,
+		"output format: table or json")
+	silenceCmd.PersistentFlags().StringVar(&manualCreatedBy, "created-by", silence.DefaultManualCreatedBy,
+		"createdBy value of the silences created, listed and expired, distinct from --silence-created-by so that the silencer cleanup keeps them")
+	silenceCmd.Flags().StringVar(&silenceFor, "duration", "",
+		"silence duration in Go duration format (default --silence-duration)")
+
+	createCmd := &cobra.Command{
+		Use:           "create",
+		Short:         "Create the silences of the nodes from now on for the duration",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE:          runSilenceCreate,
+	}
+	createCmd.Flags().StringVar(&silenceFor, "duration", "",
+		"silence duration in Go duration format (default --silence-duration)")
+
+	listCmd := &cobra.Command{
+		Use:           "list",
+		Short:         "List the active and pending silences of the nodes, or every silence created by --created-by",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE:          runSilenceList,
+	}
+
+	expireCmd := &cobra.Command{
+		Use:           "expire",
+		Short:         "Expire the active and pending silences of the nodes",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE:          runSilenceExpire,
+	}
+
+	silenceCmd.AddCommand(createCmd, listCmd, expireCmd)
+	return silenceCmd
+}
+
+// newSilenceController constructs a controller with the node silence settings and the targets of the flags,
+// reporting every configuration problem at once. The cluster is only needed by the tenants templated from the node
+// labels
+func newSilenceController() (*controller.Controller, error) {
+	if outputFormat != outputTable && outputFormat != outputJSON {
+		return nil, fmt.Errorf("--output: unknown output format: %s", outputFormat)
+	}
+
+	errs := []error{}
+	if manualCreatedBy == silenceCreatedBy {
+		errs = append(errs, fmt.Errorf("--created-by: %s is the createdBy of the silencer, whose cleanup would expire the silences", manualCreatedBy))
+	}
+	timeout, err := time.ParseDuration(alertmanagerTimeout)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("--alertmanager-timeout: %w", err))
+	}
+	nodeExclusions, _, _, err := parseExclusionFlags()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	targets, err := newTargets(timeout)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if err := controller.ValidateTargetExclusions(targets, nodeExclusions); err != nil {
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	var client kubernetes.Interface
+	if kubeClient, err := newKubeClient(); err == nil {
+		client = kubeClient
+	} else {
+		log.WithError(err).Debug("no access to the cluster, the node labels can't be read")
+	}
+
+	silencerPod, _ := os.Hostname()
+	return controller.New(client, controller.Config{
+		Targets: targets,
+		Silence: silence.Config{
+			MatchersJSON:    silenceMatchersJSON,
+			CreatedBy:       manualCreatedBy,
+			CommentTemplate: silenceComment,
+			CanaryValues:    parseCanaryValues(silenceCanaries),
+			Exclusions:      nodeExclusions,
+		},
+		TemplateData: silence.TemplateData{ClusterName: clusterName, SilencerPod: silencerPod},
+		NowProvider:  time.Now,
+	}), nil
+}
+
+// printSilences prints the silences in the --output format
+func printSilences(silences []controller.ManualSilence) error {
+	if outputFormat == outputJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(silences)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TARGET\tNODE\tSTATUS\tID\tMATCHERS\tSTARTS AT\tENDS AT")
+	for _, s := range silences {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", s.Target, s.Node, s.Status, s.ID, s.Matchers,
+			s.StartsAt.Format(time.RFC3339), s.EndsAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+// runSilenceCreate creates the silences of the nodes on every target from now on for the duration
+func runSilenceCreate(cmd *cobra.Command, args []string) error {
+	if len(silenceNodes) == 0 {
+		return fmt.Errorf("--node is required")
+	}
+	if silenceFor == "" {
+		silenceFor = silenceDuration
+	}
+	duration, err := time.ParseDuration(silenceFor)
+	if err != nil {
+		return fmt.Errorf("--duration: %w", err)
+	}
+	minDuration, err := time.ParseDuration(minSilenceDuration)
+	if err != nil {
+		return fmt.Errorf("--min-silence-duration: %w", err)
+	}
+	maxDuration, err := time.ParseDuration(maxSilenceDuration)
+	if err != nil {
+		return fmt.Errorf("--max-silence-duration: %w", err)
+	}
+	if duration < minDuration || duration > maxDuration {
+		return fmt.Errorf("--duration: silence duration %s is not between %s and %s", duration, minDuration, maxDuration)
+	}
+
+	c, err := newSilenceController()
+	if err != nil {
+		return err
+	}
+	if err := c.ValidateSilence(minDuration, maxDuration); err != nil {
+		return err
+	}
+
+	silences, err := c.SilenceNodes(cmd.Context(), silenceNodes, duration)
+	if printErr := printSilences(silences); printErr != nil {
+		return printErr
+	}
+	return err
+}
+
+// runSilenceList lists the silences of the nodes on every target, or every silence created by --created-by
+func runSilenceList(cmd *cobra.Command, args []string) error {
+	c, err := newSilenceController()
+	if err != nil {
+		return err
+	}
+
+	silences, err := c.ListSilences(cmd.Context(), silenceNodes)
+	if printErr := printSilences(silences); printErr != nil {
+		return printErr
+	}
+	return err
+}
+
+// runSilenceExpire expires the silences of the nodes on every target
+func runSilenceExpire(cmd *cobra.Command, args []string) error {
+	if len(silenceNodes) == 0 {
+		return fmt.Errorf("--node is required")
+	}
+	c, err := newSilenceController()
+	if err != nil {
+		return err
+	}
+
+	silences, err := c.ExpireNodes(cmd.Context(), silenceNodes)
+	if printErr := printSilences(silences); printErr != nil {
+		return printErr
+	}
+	return err
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/trustyou/kured-alert-silencer/pkg/controller"
+	"github.com/trustyou/kured-alert-silencer/pkg/kured"
+	"github.com/trustyou/kured-alert-silencer/pkg/silence"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// newStatusCommand constructs the status command, printing the nodes holding the kured lock with their expected
+// silence window, their silences and the gaps between both
+func newStatusCommand() *cobra.Command {
+	statusCmd := &cobra.Command{
+		Use:           "status",
+		Short:         "Print the nodes holding the kured lock, their expected and actual silences and any gap",
+		Example:       "kured-alert-silencer status -o json",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		// replaces the root one, which only binds the environment variables
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := bindViper(cmd, args); err != nil {
+				return err
+			}
+			return setupLogging()
+		},
+		RunE: runStatus,
+	}
+	statusCmd.Flags().StringVarP(&outputFormat, "output", "o", outputTable,
+		"output format: table or json")
+	return statusCmd
+}
+
+// newKubeClient returns a client of the cluster the silencer runs in, or of the current kubeconfig context outside of
+// it
+func newKubeClient() (kubernetes.Interface, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		config, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{}).ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the kubernetes configuration: %w", err)
+		}
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+// newStatusController constructs a controller reading the lock and the silences with the settings of the flags,
+// reporting every configuration problem at once
+func newStatusController() (*controller.Controller, error) {
+	if outputFormat != outputTable && outputFormat != outputJSON {
+		return nil, fmt.Errorf("--output: unknown output format: %s", outputFormat)
+	}
+
+	errs := []error{}
+	parseDuration := func(flag string, value string) time.Duration {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("--%s: %w", flag, err))
+		}
+		return duration
+	}
+	window := kured.SilenceWindow{
+		Duration: parseDuration("silence-duration", silenceDuration),
+		Lag:      parseDuration("silence-lag-time", silenceLagTime),
+	}
+	timeout := parseDuration("alertmanager-timeout", alertmanagerTimeout)
+
+	var schedule *controller.Schedule
+	if rebootDays != controller.DefaultScheduleDays || startTime != controller.DefaultScheduleStartTime || endTime != controller.DefaultScheduleEndTime {
+		var err error
+		schedule, err = controller.ParseSchedule(rebootDays, startTime, endTime, timeZone)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("schedule: %w", err))
+		}
+	}
+
+	nodeExclusions, _, _, err := parseExclusionFlags()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	targets, err := newTargets(timeout)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	client, err := newKubeClient()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	var lockSource kured.LockSource
+	switch lockSourceType {
+	case kured.LockSourceDaemonSet:
+		lockSource = kured.NewDaemonSetLockSource(client, dsNamespace, dsName, lockAnnotation)
+	case kured.LockSourceLease:
+		lockSource = kured.NewLeaseLockSource(client, leaseNamespace, leaseName)
+	default:
+		errs = append(errs, fmt.Errorf("--lock-source: unknown lock source: %s", lockSourceType))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	return controller.New(client, controller.Config{
+		LockSource: lockSource,
+		Targets:    targets,
+		Silence: silence.Config{
+			MatchersJSON:    silenceMatchersJSON,
+			CreatedBy:       silenceCreatedBy,
+			CommentTemplate: silenceComment,
+			CanaryValues:    parseCanaryValues(silenceCanaries),
+			Exclusions:      nodeExclusions,
+		},
+		TemplateData: silence.TemplateData{ClusterName: clusterName},
+		Window:       window,
+		NowProvider:  time.Now,
+		Schedule:     schedule,
+	}), nil
+}
+
+// runStatus prints the status of the nodes holding the kured lock and the silences matching none of them
+func runStatus(cmd *cobra.Command, args []string) error {
+	c, err := newStatusController()
+	if err != nil {
+		return err
+	}
+	status, err := c.Status(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	if outputFormat == outputJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(status)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tLOCK AGE\tWINDOW START\tWINDOW END\tSILENCES\tGAPS")
+	for _, node := range status.Nodes {
+		gaps := "-"
+		if len(node.Gaps) > 0 {
+			gaps = strings.Join(node.Gaps, "; ")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", node.Node, node.LockAge.Round(time.Second),
+			node.WindowStart.Format(time.RFC3339), node.WindowEnd.Format(time.RFC3339), len(node.Silences), gaps)
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "TARGET\tNODE\tSTATUS\tID\tMATCHERS\tSTARTS AT\tENDS AT")
+	for _, node := range status.Nodes {
+		for _, s := range node.Silences {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", s.Target, node.Node, s.State, s.ID, s.MatchersString(),
+				s.StartsAt.Format(time.RFC3339), s.EndsAt.Format(time.RFC3339))
+		}
+	}
+	for _, s := range status.Unmatched {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", s.Target, "-", s.State, s.ID, s.MatchersString(),
+			s.StartsAt.Format(time.RFC3339), s.EndsAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/trustyou/kured-alert-silencer/pkg/kured"
+	"github.com/trustyou/kured-alert-silencer/pkg/silence"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CleanupOrphanedSilences expires the silences created by the silencer that no longer correspond to an active reboot:
+// nodes holding the kured lock, rebooting according to their state or in their release lag, their pods, and nodes
+// with a pending reboot
+func (c *Controller) CleanupOrphanedSilences(ctx context.Context) error {
+	keep, err := c.keptSilences(ctx)
+	if err != nil {
+		return err
+	}
+
+	errs := []error{}
+	for _, target := range c.config.Targets {
+		tenants, err := c.targetTenants(ctx, target)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", target.Name, err))
+			continue
+		}
+		for _, tenant := range tenants {
+			expired, err := silence.ExpireOrphanedSilences(silence.WithTenant(ctx, tenant), target.Silencer, c.config.Silence.CreatedBy, keep)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", target.Name, err))
+			}
+			c.notify(target, "", expired, err)
+			if tenant != "" {
+				log.Infof("expired %d orphaned silences on %s for tenant %s", len(expired), target.Name, tenant)
+				continue
+			}
+			log.Infof("expired %d orphaned silences on %s", len(expired), target.Name)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// keptSilences returns whether a silence matches an active reboot, any failure aborts the cleanup so that silences
+// are never expired from a partial view. The trackers are empty after a restart, so every silence mentioning a
+// rebooting node is kept, e.g. the silences of the pods already evicted, and so are the silences ending within the
+// release lag, which may be the lag of a lock released before the restart
+func (c *Controller) keptSilences(ctx context.Context) (func(s silence.Silence) bool, error) {
+	now := c.config.NowProvider()
+	expected := map[string]bool{}
+	addKeys := func(silenceConfig silence.Config, data silence.TemplateData) error {
+		keys, err := silence.SilenceKeys(silenceConfig, data)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			expected[key] = true
+		}
+		return nil
+	}
+
+	lock := &kured.Lock{}
+	obj, err := c.config.LockSource.Get(ctx)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	if err == nil {
+		lock, err = c.config.LockSource.Lock(obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+	lock = c.firstSeen.ResolveCreated(lock, c.config.NowProvider)
+
+	nodes := []corev1.Node{}
+	if c.config.DetectRebootingNodes || c.config.PreReboot.NodeKey != "" {
+		nodeList, err := c.client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		nodes = nodeList.Items
+	}
+
+	silencerArray := kured.ExtractSilenceNodes(lock, c.config.Window, c.config.NowProvider)
+	silenceNodes := append(silencerArray, c.nodeDetector.ActiveWindows(c.config.NowProvider)...)
+	if c.config.DetectRebootingNodes {
+		for _, node := range nodes {
+			if silenceNode, rebooting := c.nodeDetector.ExtractRebootingNode(&node, c.config.Window, c.config.NowProvider); rebooting {
+				silenceNodes = append(silenceNodes, silenceNode)
+			}
+		}
+	}
+	rebooting := map[string]bool{}
+	for _, silenceNode := range silenceNodes {
+		rebooting[silenceNode.NodeID] = true
+		if err := addKeys(c.config.Silence, c.nodeTemplateData(silenceNode)); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.config.Pods.Mode != "" {
+		for _, silenceNode := range silencerArray {
+			templateData, err := c.podTemplateData(ctx, silenceNode)
+			if err != nil {
+				return nil, err
+			}
+			for _, data := range templateData {
+				if err := addKeys(c.config.podSilenceConfig(), data); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	pendingNodes := []string{}
+	if c.config.PreReboot.NodeKey != "" {
+		for _, node := range nodes {
+			if kured.RebootRequiredNode(&node, c.config.PreReboot.NodeKey) {
+				pendingNodes = append(pendingNodes, node.Name)
+			}
+		}
+	}
+	if c.config.PreReboot.MetricsURL != "" {
+		nodeNames, err := c.fetchRebootRequiredNodes(ctx)
+		if err != nil {
+			return nil, err
+		}
+		pendingNodes = append(pendingNodes, nodeNames...)
+	}
+	for _, nodeName := range pendingNodes {
+		if err := addKeys(c.config.PreReboot.Silence, c.nodeTemplateData(kured.SilenceNode{NodeID: nodeName})); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(s silence.Silence) bool {
+		if expected[s.Key()] || !s.EndsAt.After(now.Add(c.config.Window.Lag)) {
+			return true
+		}
+		for nodeName := range rebooting {
+			if s.References(nodeName) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
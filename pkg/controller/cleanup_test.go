@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go/ptr"
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trustyou/kured-alert-silencer/pkg/kured"
+	"github.com/trustyou/kured-alert-silencer/pkg/silence"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newMatcher(name string, value string) *models.Matcher {
+	return &models.Matcher{Name: ptr.String(name), Value: ptr.String(value), IsRegex: ptr.Bool(false)}
+}
+
+// createSilences creates active silences for the given matchers and returns their IDs
+func createSilences(t *testing.T, silencer silence.Silencer, now time.Time, createdBy string, silences ...[]*models.Matcher) []string {
+	ids := []string{}
+	for _, matchers := range silences {
+		id, err := silencer.CreateSilence(context.Background(), silence.Silence{
+			Matchers:  matchers,
+			StartsAt:  now.Add(-time.Minute),
+			EndsAt:    now.Add(time.Hour),
+			CreatedBy: createdBy,
+		})
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// expiredSilences returns the IDs of the expired silences
+func expiredSilences(silencer *silence.FakeSilencer) []string {
+	ids := []string{}
+	for _, s := range silencer.Silences() {
+		if s.State == models.SilenceStatusStateExpired {
+			ids = append(ids, s.ID)
+		}
+	}
+	return ids
+}
+
+func TestCleanupOrphanedSilences(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	controller, silencer := newTestController(func() time.Time {
+		return now
+	})
+
+	ids := createSilences(t, silencer, now, silence.DefaultCreatedBy,
+		[]*models.Matcher{newMatcher("instance", "kind-worker")},
+		[]*models.Matcher{newMatcher("instance", "kind-worker2")},
+		[]*models.Matcher{newMatcher("instance", "kind-worker3")},
+		[]*models.Matcher{newMatcher("instance", "kind-worker4"), newMatcher("alertname", "RebootRequired")},
+		[]*models.Matcher{newMatcher("alertname", "RebootRequired"), newMatcher("instance", "kind-worker5")},
+	)
+	createSilences(t, silencer, now, "someone", []*models.Matcher{newMatcher("instance", "kind-worker6")})
+
+	ctx := context.Background()
+	_, err := controller.client.AppsV1().DaemonSets("kube-system").Create(ctx, &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "kured",
+			Namespace:   "kube-system",
+			Annotations: map[string]string{KuredNodeLockAnnotation: `{"nodeID":"kind-worker","metadata":{"unschedulable":false},"created":"2024-05-31T06:31:00Z","TTL":0}`},
+		},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = controller.client.CoreV1().Nodes().Create(ctx, &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "kind-worker4", Labels: map[string]string{"example.com/reboot-required": "true"}},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	// kind-worker2 is in its release lag window
+	controller.nodeDetector.RecordWindows([]kured.SilenceNode{{NodeID: "kind-worker2", SilenceStart: now, SilenceEnd: now.Add(10 * time.Minute)}})
+
+	err = controller.CleanupOrphanedSilences(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{ids[2], ids[4]}, expiredSilences(silencer))
+}
+
+func TestCleanupOrphanedSilencesWithoutLock(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	controller, silencer := newTestController(func() time.Time {
+		return now
+	})
+	ids := createSilences(t, silencer, now, silence.DefaultCreatedBy, []*models.Matcher{newMatcher("instance", "kind-worker")})
+	createSilences(t, silencer, now, silence.DefaultCreatedBy, []*models.Matcher{newMatcher("instance", "kind-worker2")})
+
+	// silences are kept when the expected silences can't be computed
+	controller.config.PreReboot.MetricsURL = "http://localhost/%zz"
+	err := controller.CleanupOrphanedSilences(context.Background())
+	require.Error(t, err)
+	assert.Empty(t, expiredSilences(silencer))
+
+	// a missing lock object means no node is rebooting
+	controller.config.PreReboot.MetricsURL = ""
+	err = controller.CleanupOrphanedSilences(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{ids[0], "00000000-0000-0000-0000-000000000002"}, expiredSilences(silencer))
+}
+
+func TestCleanupOrphanedSilencesAfterRestart(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	controller, silencer := newTestController(func() time.Time {
+		return now
+	})
+	controller.config.Pods = PodSilenceConfig{Mode: PodSilenceModePod, MatchersJSON: DefaultPodMatchersJSON}
+	ctx := context.Background()
+
+	create := func(comment string, endsAt time.Time, matchers ...*models.Matcher) string {
+		id, err := silencer.CreateSilence(ctx, silence.Silence{
+			Matchers:  matchers,
+			StartsAt:  now.Add(-10 * time.Minute),
+			EndsAt:    endsAt,
+			CreatedBy: silence.DefaultCreatedBy,
+			Comment:   comment,
+		})
+		require.NoError(t, err)
+		return id
+	}
+	// kind-worker holds the lock and its pods were evicted before the restart
+	create("kind-worker", now.Add(time.Hour), newMatcher("instance", "kind-worker"))
+	create("test: kind-worker", now.Add(time.Hour), newMatcher("namespace", "default"), newMatcher("pod", "web-6d4cf56db6-abcde"))
+	// the lock of kind-worker2 was released before the restart, its lag ends in 5 minutes
+	create("test: kind-worker2", now.Add(5*time.Minute), newMatcher("instance", "kind-worker2"))
+	// kind-worker3 is rebooting according to its state, the lock was missed
+	create("test: kind-worker3", now.Add(time.Hour), newMatcher("instance", "kind-worker3"))
+	// the reboots of kind-worker4 and of its pods are over
+	orphans := []string{
+		create("test: kind-worker4", now.Add(time.Hour), newMatcher("instance", "kind-worker4")),
+		create("test: kind-worker4", now.Add(time.Hour), newMatcher("namespace", "default"), newMatcher("pod", "db-0")),
+	}
+
+	_, err := controller.client.AppsV1().DaemonSets("kube-system").Create(ctx, &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "kured",
+			Namespace:   "kube-system",
+			Annotations: map[string]string{KuredNodeLockAnnotation: `{"nodeID":"kind-worker","created":"2024-05-31T06:31:00Z","TTL":0}`},
+		},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = controller.client.CoreV1().Nodes().Create(ctx, &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "kind-worker3", Annotations: map[string]string{kured.KuredRebootInProgressAnnotation: "2024-05-31T06:35:00Z"}},
+		Spec:       corev1.NodeSpec{Unschedulable: true},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, controller.CleanupOrphanedSilences(ctx))
+	assert.Equal(t, orphans, expiredSilences(silencer))
+}
@@ -0,0 +1,425 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/trustyou/kured-alert-silencer/pkg/kured"
+	"github.com/trustyou/kured-alert-silencer/pkg/silence"
+	"github.com/trustyou/kured-alert-silencer/pkg/webhook"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Config holds the settings of the controller
+type Config struct {
+	LockSource kured.LockSource
+	// Targets receive every silence
+	Targets []Target
+	Silence silence.Config
+	// TemplateData holds the values shared by every silence, node values are filled by the controller
+	TemplateData silence.TemplateData
+	Window       kured.SilenceWindow
+	NowProvider  kured.TimeProvider
+	// DetectRebootingNodes silences nodes that look rebooted by kured while watching Nodes
+	DetectRebootingNodes bool
+	// RebootInProgressAnnotation is the node annotation set by kured while rebooting a node
+	RebootInProgressAnnotation string
+	PreReboot                  PreRebootConfig
+	Pods                       PodSilenceConfig
+	Retry                      RetryConfig
+	Guard                      GuardConfig
+	// Schedule restricts the silences to the reboots started inside it, every reboot is silenced when nil
+	Schedule *Schedule
+	// ShutdownTimeout bounds the time spent completing in-flight silences once the controller is stopped
+	ShutdownTimeout time.Duration
+	// Notifier receives the silences created, extended, expired or failing, disabled when nil
+	Notifier Notifier
+}
+
+// Notifier receives the changes of the silences, e.g. a webhook.Sink
+type Notifier interface {
+	Notify(event webhook.Event)
+}
+
+// Target is a named silence backend
+type Target struct {
+	Name     string
+	Silencer silence.Silencer
+	// Tenant is the tenant ID template rendered per node and sent on every request of the silencer
+	Tenant string
+	// Maintenance targets mute whole services, they only get the silences of the reboot windows of the nodes and not
+	// the pre-reboot and pod ones, a single window per node
+	Maintenance bool
+}
+
+// silenceConfig returns the silence settings on the target, maintenance targets opening a single window per node
+// rather than one per matcher group as every window mutes the whole services
+func (t Target) silenceConfig(silenceConfig silence.Config) silence.Config {
+	silenceConfig.SingleWindow = t.Maintenance
+	return silenceConfig
+}
+
+// PreRebootConfig holds the settings of the silences created while a reboot is pending,
+// before kured takes the lock
+type PreRebootConfig struct {
+	Silence  silence.Config
+	Duration time.Duration
+	// NodeKey is the node label or annotation marking nodes requiring a reboot, disabled when empty
+	NodeKey string
+	// MetricsURL exposes the kured_reboot_required metric of the nodes, disabled when empty
+	MetricsURL   string
+	PollInterval time.Duration
+}
+
+// Controller silences alerts while kured reboots nodes
+type Controller struct {
+	client         kubernetes.Interface
+	config         Config
+	releaseTracker *kured.ReleaseTracker
+	firstSeen      *kured.FirstSeenTracker
+	nodeDetector   *kured.NodeRebootDetector
+	// pending reboots are tracked per signal, as each signal reports a different set of nodes
+	nodeKeyTracker *kured.RebootRequiredTracker
+	metricsTracker *kured.RebootRequiredTracker
+	httpClient     *http.Client
+	// podsSilenced records the lock creation time for which the pods of each node were silenced
+	podsSilenced map[string]time.Time
+	retryQueue   *retryQueue
+	metrics      *metrics
+	guardState   *guardState
+	// outOfSchedule records the lock creation time of the reboots reported outside of the schedule
+	outOfSchedule *scheduleReports
+}
+
+func New(client kubernetes.Interface, config Config) *Controller {
+	if config.Retry.BaseDelay <= 0 {
+		config.Retry.BaseDelay = DefaultRetryBaseDelay
+	}
+	if config.Retry.MaxDelay < config.Retry.BaseDelay {
+		config.Retry.MaxDelay = DefaultRetryMaxDelay
+	}
+
+	return &Controller{
+		client:         client,
+		config:         config,
+		releaseTracker: kured.NewReleaseTracker(),
+		firstSeen:      kured.NewFirstSeenTracker(),
+		nodeDetector:   kured.NewNodeRebootDetector(config.RebootInProgressAnnotation),
+		nodeKeyTracker: kured.NewRebootRequiredTracker(),
+		metricsTracker: kured.NewRebootRequiredTracker(),
+		httpClient:     &http.Client{Timeout: 10 * time.Second},
+		podsSilenced:   map[string]time.Time{},
+		retryQueue:     newRetryQueue(config.Retry),
+		metrics:        newMetrics(),
+		guardState:     &guardState{},
+		outOfSchedule:  newScheduleReports(),
+	}
+}
+
+// Run silences alerts while kured reboots nodes until the context is cancelled, then waits up to
+// ShutdownTimeout for the in-flight silences to complete
+func (c *Controller) Run(ctx context.Context) error {
+	// in-flight work outlives the context, up to the shutdown timeout
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+
+	var wg sync.WaitGroup
+	start := func(loop func(ctx context.Context, workCtx context.Context)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			loop(ctx, workCtx)
+		}()
+	}
+
+	if c.config.DetectRebootingNodes || c.config.PreReboot.NodeKey != "" {
+		start(c.watchNodes)
+	}
+	if c.config.PreReboot.MetricsURL != "" {
+		start(c.watchRebootRequiredMetrics)
+	}
+	start(c.watchRetries)
+	start(c.watchLock)
+
+	<-ctx.Done()
+	log.Info("shutting down, waiting for in-flight silences")
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(c.config.ShutdownTimeout):
+		cancelWork()
+		<-done
+		return fmt.Errorf("in-flight silences not completed within %s", c.config.ShutdownTimeout)
+	}
+}
+
+// sleep waits for the duration, returning false when the context is cancelled first
+func sleep(ctx context.Context, duration time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(duration):
+		return true
+	}
+}
+
+// consume handles the events of a watcher until it ends, returning false when the context is cancelled first
+func consume(ctx context.Context, watcher watch.Interface, handle func(event watch.Event)) bool {
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return true
+			}
+			handle(event)
+		}
+	}
+}
+
+// watchLock silences the alerts of the nodes holding the kured lock, restarting the watch when it ends
+func (c *Controller) watchLock(ctx context.Context, workCtx context.Context) {
+	lockSource := c.config.LockSource
+
+	for {
+		log.Infof("watching %s", lockSource)
+
+		watcher, err := lockSource.Watch(ctx)
+		if err != nil {
+			log.WithError(err).Errorf("failed to create %s watcher, retrying...", lockSource)
+			if !sleep(ctx, 5*time.Second) {
+				return
+			}
+			continue
+		}
+
+		handle := func(event watch.Event) {
+			c.handleLockEvent(workCtx, event)
+		}
+		if !consume(ctx, watcher, handle) {
+			return
+		}
+	}
+}
+
+func (c *Controller) handleLockEvent(ctx context.Context, event watch.Event) {
+	lockSource := c.config.LockSource
+
+	var lock *kured.Lock
+	switch event.Type {
+	case watch.Added, watch.Modified:
+		var err error
+		lock, err = lockSource.Lock(event.Object)
+		if err != nil {
+			log.WithError(err).Errorf("failed to extract kured lock from %s", lockSource)
+			return
+		}
+		if lock.Manual {
+			log.Debug("kured is locked manually")
+		}
+	case watch.Deleted:
+		log.Infof("%s deleted", lockSource)
+		lock = &kured.Lock{}
+	case watch.Error:
+		log.Errorf("error watching %s, restarting watch...", lockSource)
+		return
+	default:
+		return
+	}
+	lock = c.firstSeen.ResolveCreated(lock, c.config.NowProvider)
+
+	silencerArray := c.scheduled(ctx, kured.ExtractSilenceNodes(lock, c.config.Window, c.config.NowProvider), event.Object)
+	releasedArray := c.scheduled(ctx, c.releaseTracker.ExtractReleasedNodes(lock, c.config.Window, c.config.NowProvider), event.Object)
+	c.outOfSchedule.prune(lock)
+	for _, releasedNode := range releasedArray {
+		log.Infof("lock released for node %s, keeping alerts silenced until %s", releasedNode.NodeID, releasedNode.SilenceEnd)
+	}
+
+	silenceNodes := append(silencerArray, releasedArray...)
+	if !c.guard(ctx, lock, silenceNodes, event.Object) {
+		return
+	}
+	c.nodeDetector.RecordWindows(silenceNodes)
+	for _, silenceNode := range silenceNodes {
+		c.silenceNode(ctx, c.config.Targets, c.config.Silence, silenceNode)
+	}
+
+	if c.config.Pods.Mode != "" {
+		c.handleLockPods(ctx, silencerArray)
+	}
+}
+
+// handleLockPods silences the pods of the nodes holding the lock, once per lock as pods are listed at lock time. The
+// pods are listed again on the next lock event when listing them failed
+func (c *Controller) handleLockPods(ctx context.Context, silencerArray []kured.SilenceNode) {
+	held := map[string]bool{}
+	for _, silenceNode := range silencerArray {
+		held[silenceNode.NodeID] = true
+		if lockCreated, ok := c.podsSilenced[silenceNode.NodeID]; ok && lockCreated.Equal(silenceNode.LockCreated) {
+			continue
+		}
+		if err := c.silencePods(ctx, silenceNode); err != nil {
+			log.WithError(err).Errorf("failed to silence alerts for the pods of node %s", silenceNode.NodeID)
+			continue
+		}
+		c.podsSilenced[silenceNode.NodeID] = silenceNode.LockCreated
+	}
+
+	for nodeID := range c.podsSilenced {
+		if !held[nodeID] {
+			delete(c.podsSilenced, nodeID)
+		}
+	}
+}
+
+// watchNodes silences the alerts of the nodes that look rebooted by kured or that require a reboot,
+// restarting the watch when it ends
+func (c *Controller) watchNodes(ctx context.Context, workCtx context.Context) {
+	for {
+		log.Info("watching Nodes")
+
+		watcher, err := c.client.CoreV1().Nodes().Watch(ctx, metav1.ListOptions{})
+		if err != nil {
+			log.WithError(err).Error("failed to create Node watcher, retrying...")
+			if !sleep(ctx, 5*time.Second) {
+				return
+			}
+			continue
+		}
+
+		handle := func(event watch.Event) {
+			c.handleNodeEvent(workCtx, event)
+		}
+		if !consume(ctx, watcher, handle) {
+			return
+		}
+	}
+}
+
+func (c *Controller) handleNodeEvent(ctx context.Context, event watch.Event) {
+	switch event.Type {
+	case watch.Added, watch.Modified:
+		node, ok := event.Object.(*corev1.Node)
+		if !ok {
+			return
+		}
+
+		if c.config.DetectRebootingNodes {
+			silenceNode, rebooting := c.nodeDetector.ExtractRebootingNode(node, c.config.Window, c.config.NowProvider)
+			if rebooting && len(c.scheduled(ctx, []kured.SilenceNode{silenceNode}, node)) > 0 && c.guard(ctx, nil, []kured.SilenceNode{silenceNode}, node) {
+				log.Debugf("node %s is rebooting according to its state", node.Name)
+				c.silenceNode(ctx, c.config.Targets, c.config.Silence, silenceNode)
+			}
+		}
+
+		if c.config.PreReboot.NodeKey != "" {
+			required := kured.RebootRequiredNode(node, c.config.PreReboot.NodeKey)
+			silenceNode, pending := c.nodeKeyTracker.ExtractPendingNode(node.Name, required, c.config.PreReboot.Duration, c.config.NowProvider)
+			if pending {
+				log.Debugf("node %s requires a reboot according to %s", node.Name, c.config.PreReboot.NodeKey)
+				c.silenceNode(ctx, c.alertTargets(), c.config.PreReboot.Silence, silenceNode)
+			}
+		}
+	case watch.Deleted:
+		if node, ok := event.Object.(*corev1.Node); ok {
+			c.nodeKeyTracker.ExtractPendingNode(node.Name, false, c.config.PreReboot.Duration, c.config.NowProvider)
+		}
+	case watch.Error:
+		log.Error("error watching Nodes, restarting watch...")
+	}
+}
+
+// watchRebootRequiredMetrics periodically silences the pending reboot alerts of the nodes reported by the kured metrics
+func (c *Controller) watchRebootRequiredMetrics(ctx context.Context, workCtx context.Context) {
+	log.Infof("polling %s every %s", c.config.PreReboot.MetricsURL, c.config.PreReboot.PollInterval)
+
+	ticker := time.NewTicker(c.config.PreReboot.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.pollRebootRequiredMetrics(workCtx); err != nil {
+			log.WithError(err).Errorf("failed to get reboot required nodes from %s", c.config.PreReboot.MetricsURL)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Controller) pollRebootRequiredMetrics(ctx context.Context) error {
+	nodeNames, err := c.fetchRebootRequiredNodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, silenceNode := range c.metricsTracker.ExtractPendingNodes(nodeNames, c.config.PreReboot.Duration, c.config.NowProvider) {
+		log.Debugf("node %s requires a reboot according to %s", silenceNode.NodeID, kured.KuredRebootRequiredMetric)
+		c.silenceNode(ctx, c.alertTargets(), c.config.PreReboot.Silence, silenceNode)
+	}
+	return nil
+}
+
+// fetchRebootRequiredNodes reads the nodes requiring a reboot from the kured metrics
+func (c *Controller) fetchRebootRequiredNodes(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.config.PreReboot.MetricsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return kured.RebootRequiredNodesFromMetrics(resp.Body)
+}
+
+// nodeTemplateData returns the template data of the silences of a node
+func (c *Controller) nodeTemplateData(silenceNode kured.SilenceNode) silence.TemplateData {
+	templateData := c.config.TemplateData
+	templateData.NodeName = silenceNode.NodeID
+	templateData.LockCreated = silenceNode.LockCreated
+	templateData.LockMetadata = silenceNode.LockMetadata
+	templateData.Unschedulable = silenceNode.Unschedulable()
+	return templateData
+}
+
+// silenceNode silences the alerts of a node on the given targets with the given silence settings
+func (c *Controller) silenceNode(ctx context.Context, targets []Target, silenceConfig silence.Config, silenceNode kured.SilenceNode) {
+	log.Infof("silencing alerts for node %s", silenceNode.NodeID)
+	if silenceNode.Unschedulable() {
+		log.Debugf("node %s was already unschedulable when kured took the lock", silenceNode.NodeID)
+	}
+
+	err := c.silence(ctx, targets, silenceConfig, c.nodeTemplateData(silenceNode), silenceNode.SilenceStart, silenceNode.SilenceEnd)
+	if err != nil {
+		log.WithError(err).Errorf("failed to silence alerts for node %s", silenceNode.NodeID)
+	}
+}
@@ -0,0 +1,289 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trustyou/kured-alert-silencer/pkg/kured"
+	"github.com/trustyou/kured-alert-silencer/pkg/silence"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const KuredNodeLockAnnotation string = "weave.works/kured-node-lock"
+
+func newTestController(nowProvider kured.TimeProvider) (*Controller, *silence.FakeSilencer) {
+	silencer := silence.NewFakeSilencer(nowProvider)
+	client := fake.NewSimpleClientset()
+	return New(client, Config{
+		LockSource: kured.NewDaemonSetLockSource(client, "kube-system", "kured", KuredNodeLockAnnotation),
+		Targets:    []Target{{Name: "test", Silencer: silencer}},
+		Silence: silence.Config{
+			MatchersJSON:    `[{"name": "instance", "value": "{{.NodeName}}", "isRegex": false}]`,
+			CreatedBy:       silence.DefaultCreatedBy,
+			CommentTemplate: "{{.ClusterName}}: {{.NodeName}}",
+		},
+		TemplateData:               silence.TemplateData{ClusterName: "test"},
+		Window:                     kured.SilenceWindow{Duration: time.Hour, Lag: 10 * time.Minute},
+		NowProvider:                nowProvider,
+		DetectRebootingNodes:       true,
+		RebootInProgressAnnotation: kured.KuredRebootInProgressAnnotation,
+		PreReboot: PreRebootConfig{
+			Silence: silence.Config{
+				MatchersJSON:    `[{"matchers": [{"name": "alertname", "value": "RebootRequired", "isRegex": false}, {"name": "instance", "value": "{{.NodeName}}", "isRegex": false}]}]`,
+				CreatedBy:       silence.DefaultCreatedBy,
+				CommentTemplate: "pending reboot: {{.NodeName}}",
+			},
+			Duration:     30 * time.Minute,
+			NodeKey:      "example.com/reboot-required",
+			PollInterval: time.Minute,
+		},
+		ShutdownTimeout: time.Second,
+	}), silencer
+}
+
+func TestHandleLockEvent(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+
+	controller, silencer := newTestController(func() time.Time {
+		return now
+	})
+
+	newDaemonSet := func(annotationValue string) *appsv1.DaemonSet {
+		return &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{KuredNodeLockAnnotation: annotationValue},
+			},
+		}
+	}
+
+	controller.handleLockEvent(context.Background(), watch.Event{
+		Type:   watch.Modified,
+		Object: newDaemonSet(`{"nodeID":"kind-worker","metadata":{"unschedulable":false},"created":"2024-05-31T05:45:00Z","TTL":0}`),
+	})
+	silences := silencer.Silences()
+	require.Len(t, silences, 1)
+	assert.Equal(t, "kind-worker", *silences[0].Matchers[0].Value)
+	assert.Equal(t, "test: kind-worker", silences[0].Comment)
+	assert.Equal(t, time.Date(2024, time.May, 31, 6, 45, 0, 0, time.UTC), silences[0].EndsAt)
+
+	// the same lock is already silenced
+	controller.handleLockEvent(context.Background(), watch.Event{
+		Type:   watch.Modified,
+		Object: newDaemonSet(`{"nodeID":"kind-worker","metadata":{"unschedulable":false},"created":"2024-05-31T05:45:00Z","TTL":0}`),
+	})
+	require.Len(t, silencer.Silences(), 1)
+
+	// released lock keeps the node silenced for the lag time
+	controller.handleLockEvent(context.Background(), watch.Event{
+		Type:   watch.Modified,
+		Object: newDaemonSet(`{"maxOwners":2,"locks":[]}`),
+	})
+	silences = silencer.Silences()
+	require.Len(t, silences, 2)
+	assert.Equal(t, now.Add(10*time.Minute), silences[1].EndsAt)
+
+	// invalid lock is ignored
+	controller.handleLockEvent(context.Background(), watch.Event{
+		Type:   watch.Modified,
+		Object: newDaemonSet(`{"unknown":true}`),
+	})
+	require.Len(t, silencer.Silences(), 2)
+}
+
+func TestHandleNodeEvent(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+
+	controller, silencer := newTestController(func() time.Time {
+		return now
+	})
+
+	controller.handleNodeEvent(context.Background(), watch.Event{
+		Type: watch.Modified,
+		Object: &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "kind-worker"},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+			},
+		},
+	})
+	require.Len(t, silencer.Silences(), 0)
+
+	controller.handleNodeEvent(context.Background(), watch.Event{
+		Type: watch.Modified,
+		Object: &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "kind-worker",
+				Annotations: map[string]string{kured.KuredRebootInProgressAnnotation: "2024-05-31T06:31:00Z"},
+			},
+			Spec: corev1.NodeSpec{Unschedulable: true},
+		},
+	})
+	require.Len(t, silencer.Silences(), 1)
+	assert.Equal(t, "kind-worker", *silencer.Silences()[0].Matchers[0].Value)
+	assert.Equal(t, time.Date(2024, time.May, 31, 7, 31, 0, 0, time.UTC), silencer.Silences()[0].EndsAt)
+}
+
+func TestHandleNodeEventPreReboot(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+
+	controller, silencer := newTestController(func() time.Time {
+		return now
+	})
+
+	controller.handleNodeEvent(context.Background(), watch.Event{
+		Type: watch.Modified,
+		Object: &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "kind-worker",
+				Labels: map[string]string{"example.com/reboot-required": "true"},
+			},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+			},
+		},
+	})
+	require.Len(t, silencer.Silences(), 1)
+	require.Len(t, silencer.Silences()[0].Matchers, 2)
+	assert.Equal(t, "RebootRequired", *silencer.Silences()[0].Matchers[0].Value)
+	assert.Equal(t, "kind-worker", *silencer.Silences()[0].Matchers[1].Value)
+	assert.Equal(t, "pending reboot: kind-worker", silencer.Silences()[0].Comment)
+	assert.Equal(t, now.Add(30*time.Minute), silencer.Silences()[0].EndsAt)
+}
+
+func TestMaintenanceTargets(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+
+	controller, silencer := newTestController(func() time.Time {
+		return now
+	})
+	maintenance := silence.NewFakeSilencer(controller.config.NowProvider)
+	controller.config.Targets = append(controller.config.Targets, Target{Name: "pagerduty", Silencer: maintenance, Maintenance: true})
+	for _, obj := range podObjects() {
+		require.NoError(t, controller.client.(*fake.Clientset).Tracker().Add(obj))
+	}
+	controller.config.Pods = PodSilenceConfig{Mode: PodSilenceModeWorkload, MatchersJSON: DefaultWorkloadMatchersJSON}
+
+	// a pending reboot only silences the alerts
+	controller.handleNodeEvent(context.Background(), watch.Event{
+		Type: watch.Modified,
+		Object: &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "kind-worker",
+				Labels: map[string]string{"example.com/reboot-required": "true"},
+			},
+		},
+	})
+	require.Len(t, silencer.Silences(), 1)
+	require.Empty(t, maintenance.Silences())
+
+	// the reboot window opens a single maintenance window too, the pods are only silenced on Alertmanager
+	controller.config.Silence.MatchersJSON = `[{"matchers": [{"name": "instance", "value": "{{.NodeName}}", "isRegex": false}]}, ` +
+		`{"matchers": [{"name": "node", "value": "{{.NodeName}}", "isRegex": false}], "delay": "5m"}]`
+	controller.handleLockEvent(context.Background(), watch.Event{
+		Type: watch.Modified,
+		Object: &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{KuredNodeLockAnnotation: `{"nodeID":"kind-worker","created":"2024-05-31T06:31:00Z","TTL":0}`},
+			},
+		},
+	})
+	require.Len(t, silencer.Silences(), 13)
+	require.Len(t, maintenance.Silences(), 1)
+	assert.Equal(t, "kind-worker", *maintenance.Silences()[0].Matchers[0].Value)
+	assert.Equal(t, time.Date(2024, time.May, 31, 7, 31, 0, 0, time.UTC), maintenance.Silences()[0].EndsAt)
+
+	// the status expects that single window
+	_, err := controller.client.AppsV1().DaemonSets("kube-system").Create(context.Background(), &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "kured",
+			Namespace:   "kube-system",
+			Annotations: map[string]string{KuredNodeLockAnnotation: `{"nodeID":"kind-worker","created":"2024-05-31T06:31:00Z","TTL":0}`},
+		},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	status, err := controller.Status(context.Background())
+	require.NoError(t, err)
+	require.Len(t, status.Nodes, 1)
+	assert.Empty(t, status.Nodes[0].Gaps)
+}
+
+func TestPollRebootRequiredMetrics(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+
+	metrics := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`# HELP kured_reboot_required OS requires reboot due to software updates.
+# TYPE kured_reboot_required gauge
+kured_reboot_required{node="kind-worker"} 1
+kured_reboot_required{node="kind-worker2"} 0
+`))
+	}))
+	defer metrics.Close()
+
+	controller, silencer := newTestController(func() time.Time {
+		return now
+	})
+	controller.config.PreReboot.MetricsURL = metrics.URL
+
+	err := controller.pollRebootRequiredMetrics(context.Background())
+	require.NoError(t, err)
+	require.Len(t, silencer.Silences(), 1)
+	assert.Equal(t, "kind-worker", *silencer.Silences()[0].Matchers[1].Value)
+
+	controller.config.PreReboot.MetricsURL = metrics.URL + "/%zz"
+	err = controller.pollRebootRequiredMetrics(context.Background())
+	require.Error(t, err)
+}
+
+// fakeLockSource sends the lock events of a fake watcher
+type fakeLockSource struct {
+	kured.LockSource
+	watcher *watch.FakeWatcher
+}
+
+func (s *fakeLockSource) Watch(ctx context.Context) (watch.Interface, error) {
+	return s.watcher, nil
+}
+
+func TestRun(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+
+	controller, silencer := newTestController(func() time.Time {
+		return now
+	})
+	watcher := watch.NewFake()
+	controller.config.LockSource = &fakeLockSource{LockSource: controller.config.LockSource, watcher: watcher}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	result := make(chan error)
+	go func() {
+		result <- controller.Run(ctx)
+	}()
+
+	// the fake watcher blocks until the previous event is handled
+	watcher.Add(&appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{KuredNodeLockAnnotation: `{"nodeID":"kind-worker","metadata":{"unschedulable":false},"created":"2024-05-31T06:31:00Z","TTL":0}`},
+		},
+	})
+	watcher.Error(&metav1.Status{})
+
+	require.Len(t, silencer.Silences(), 1)
+
+	cancel()
+	select {
+	case err := <-result:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("controller did not stop after the context was cancelled")
+	}
+}
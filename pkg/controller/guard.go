@@ -0,0 +1,242 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/trustyou/kured-alert-silencer/pkg/kured"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/reference"
+)
+
+const (
+	// GuardReasonTooManyNodes is the reason of the refusals exceeding the maximum number of silenced nodes
+	GuardReasonTooManyNodes = "TooManySilencedNodes"
+	// GuardReasonMaxOwnersExceeded is the reason of the refusals of multi locks with more holders than maxOwners
+	GuardReasonMaxOwnersExceeded = "LockHoldersAboveMaxOwners"
+	// GuardReasonMaxOwnersAboveLimit warns that the kured concurrency exceeds the maximum number of silenced nodes
+	GuardReasonMaxOwnersAboveLimit = "MaxOwnersAboveSilenceLimit"
+	// GuardReasonBroadMatchers is the reason of the refusals of silences without a node matcher or matching a canary
+	GuardReasonBroadMatchers = "BroadSilenceMatchers"
+
+	// eventSource is the component of the Kubernetes Events emitted by the silencer
+	eventSource = "kured-alert-silencer"
+
+	// guardNodeCountTTL is how long the number of Nodes of a percentage limit is reused before listing them again
+	guardNodeCountTTL = time.Minute
+)
+
+// GuardConfig holds the blast-radius guard refusing to silence too many nodes at once, e.g. on a malformed lock
+type GuardConfig struct {
+	// MaxNodes is the maximum number of nodes silenced simultaneously, unlimited when zero
+	MaxNodes int
+	// MaxNodesPercent is the maximum percentage of the Nodes silenced simultaneously, unlimited when zero
+	MaxNodesPercent int
+}
+
+// ParseMaxSilencedNodes parses a maximum number of silenced nodes, absolute like "5" or relative to the Nodes like
+// "10%", unlimited when empty or zero
+func ParseMaxSilencedNodes(value string) (GuardConfig, error) {
+	if value == "" {
+		return GuardConfig{}, nil
+	}
+
+	if percent, ok := strings.CutSuffix(value, "%"); ok {
+		maxNodesPercent, err := strconv.Atoi(percent)
+		if err != nil || maxNodesPercent < 0 || maxNodesPercent > 100 {
+			return GuardConfig{}, fmt.Errorf("invalid maximum percentage of silenced nodes: %s", value)
+		}
+		return GuardConfig{MaxNodesPercent: maxNodesPercent}, nil
+	}
+
+	maxNodes, err := strconv.Atoi(value)
+	if err != nil || maxNodes < 0 {
+		return GuardConfig{}, fmt.Errorf("invalid maximum number of silenced nodes: %s", value)
+	}
+	return GuardConfig{MaxNodes: maxNodes}, nil
+}
+
+// guardState remembers what the guard already reported and the number of Nodes, the guard running on both the lock
+// and the Node events
+type guardState struct {
+	mu sync.Mutex
+	// warnedMaxOwners is the kured maxOwners last reported above the guard limit
+	warnedMaxOwners int
+	// refusal is the last refusal recorded as an Event, the same refusal on the following lock events is only logged
+	refusal string
+	// nodeCount is the number of Nodes listed at nodeCountTime
+	nodeCount     int
+	nodeCountTime time.Time
+}
+
+// warnMaxOwners reports whether maxOwners was not reported yet, remembering it
+func (g *guardState) warnMaxOwners(maxOwners int) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if maxOwners == g.warnedMaxOwners {
+		return false
+	}
+	g.warnedMaxOwners = maxOwners
+	return true
+}
+
+// refused reports whether the refusal differs from the previous one, remembering it. An empty refusal resets it once
+// the lock is silenced again
+func (g *guardState) refused(refusal string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if refusal == g.refusal {
+		return false
+	}
+	g.refusal = refusal
+	return true
+}
+
+// nodes returns the number of Nodes listed less than guardNodeCountTTL ago, false when it has to be listed again
+func (g *guardState) nodes(now time.Time) (int, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.nodeCountTime.IsZero() || now.Sub(g.nodeCountTime) >= guardNodeCountTTL {
+		return 0, false
+	}
+	return g.nodeCount, true
+}
+
+func (g *guardState) setNodes(nodeCount int, now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.nodeCount = nodeCount
+	g.nodeCountTime = now
+}
+
+// guardLimit returns the maximum number of nodes silenced simultaneously, zero when unlimited. A percentage allows
+// at least one node, the Nodes being listed at most once per guardNodeCountTTL
+func (c *Controller) guardLimit(ctx context.Context) (int, error) {
+	limit := c.config.Guard.MaxNodes
+	if c.config.Guard.MaxNodesPercent > 0 {
+		now := c.config.NowProvider()
+		nodeCount, ok := c.guardState.nodes(now)
+		if !ok {
+			nodes, err := c.client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return 0, err
+			}
+			nodeCount = len(nodes.Items)
+			c.guardState.setNodes(nodeCount, now)
+		}
+		percentLimit := max(1, nodeCount*c.config.Guard.MaxNodesPercent/100)
+		if limit == 0 || percentLimit < limit {
+			limit = percentLimit
+		}
+	}
+	return limit, nil
+}
+
+// guard reports whether the nodes may be silenced, on top of the nodes holding the lock and the released ones still in
+// their lag window. A refusal is logged and counted, and recorded as a Warning Event on the object unless it repeats
+// the previous one
+func (c *Controller) guard(ctx context.Context, lock *kured.Lock, silenceNodes []kured.SilenceNode, obj runtime.Object) bool {
+	if lock != nil && lock.Format == kured.LockFormatMulti && lock.MaxOwners > 0 && len(lock.Holders) > lock.MaxOwners {
+		c.refuse(ctx, obj, GuardReasonMaxOwnersExceeded, fmt.Sprintf("refusing to silence nodes: the kured lock has %d holders for maxOwners %d", len(lock.Holders), lock.MaxOwners))
+		return false
+	}
+
+	silenced := map[string]bool{}
+	for _, nodeName := range c.releaseTracker.SilencedNodes(c.config.NowProvider) {
+		silenced[nodeName] = true
+	}
+	for _, silenceNode := range silenceNodes {
+		silenced[silenceNode.NodeID] = true
+	}
+	nodeNames := []string{}
+	for nodeName := range silenced {
+		nodeNames = append(nodeNames, nodeName)
+	}
+	sort.Strings(nodeNames)
+	c.metrics.setSilencedNodes(len(nodeNames))
+
+	if c.config.Guard == (GuardConfig{}) {
+		return true
+	}
+	limit, err := c.guardLimit(ctx)
+	if err != nil {
+		log.WithError(err).Error("failed to compute the maximum number of silenced nodes, refusing to silence nodes")
+		return false
+	}
+
+	if lock != nil && lock.MaxOwners > limit && c.guardState.warnMaxOwners(lock.MaxOwners) {
+		message := fmt.Sprintf("kured maxOwners %d exceeds the maximum of %d silenced nodes", lock.MaxOwners, limit)
+		log.Warn(message)
+		c.recordEvent(ctx, obj, GuardReasonMaxOwnersAboveLimit, message)
+	}
+
+	if len(nodeNames) > limit {
+		c.refuse(ctx, obj, GuardReasonTooManyNodes, fmt.Sprintf("refusing to silence %d nodes simultaneously, above the maximum of %d: %s", len(nodeNames), limit, strings.Join(nodeNames, ", ")))
+		return false
+	}
+	if lock != nil {
+		c.guardState.refused("")
+	}
+	return true
+}
+
+// refuse logs and counts a refusal of the guard, recording it as an Event unless it repeats the previous refusal
+func (c *Controller) refuse(ctx context.Context, obj runtime.Object, reason string, message string) {
+	log.Error(message)
+	c.metrics.refused(reason)
+	if c.guardState.refused(reason + ": " + message) {
+		c.recordEvent(ctx, obj, reason, message)
+	}
+}
+
+// recordEvent records a Warning Event on the object, Events are best effort
+func (c *Controller) recordEvent(ctx context.Context, obj runtime.Object, reason string, message string) {
+	if obj == nil {
+		return
+	}
+	ref, err := reference.GetReference(scheme.Scheme, obj)
+	if err != nil {
+		log.WithError(err).Warn("failed to reference the object of the event")
+		return
+	}
+
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	now := metav1.NewTime(c.config.NowProvider())
+	_, err = c.client.CoreV1().Events(namespace).Create(ctx, &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			// unique like the names of the client-go event recorder, which are based on the time
+			Name:      fmt.Sprintf("%s.%x", ref.Name, rand.Uint64()),
+			Namespace: namespace,
+		},
+		InvolvedObject: *ref,
+		Reason:         reason,
+		Message:        message,
+		Type:           corev1.EventTypeWarning,
+		Source:         corev1.EventSource{Component: eventSource},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}, metav1.CreateOptions{})
+	if err != nil {
+		log.WithError(err).Warnf("failed to record %s event", reason)
+	}
+}
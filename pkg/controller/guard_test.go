@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trustyou/kured-alert-silencer/pkg/kured"
+	"github.com/trustyou/kured-alert-silencer/pkg/silence"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestParseMaxSilencedNodes(t *testing.T) {
+	tests := []struct {
+		value     string
+		want      GuardConfig
+		expectErr bool
+	}{
+		{value: "", want: GuardConfig{}},
+		{value: "0", want: GuardConfig{}},
+		{value: "5", want: GuardConfig{MaxNodes: 5}},
+		{value: "10%", want: GuardConfig{MaxNodesPercent: 10}},
+		{value: "-1", expectErr: true},
+		{value: "150%", expectErr: true},
+		{value: "five", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			guard, err := ParseMaxSilencedNodes(tt.value)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, guard)
+		})
+	}
+}
+
+func TestGuard(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	controller, silencer := newTestController(func() time.Time {
+		return now
+	})
+	controller.config.Guard = GuardConfig{MaxNodesPercent: 50}
+	ctx := context.Background()
+	for _, nodeName := range []string{"kind-worker", "kind-worker2", "kind-worker3", "kind-worker4"} {
+		_, err := controller.client.CoreV1().Nodes().Create(ctx, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: nodeName}}, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+
+	newDaemonSet := func(annotationValue string) *appsv1.DaemonSet {
+		return &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "kured",
+				Namespace:   "kube-system",
+				Annotations: map[string]string{KuredNodeLockAnnotation: annotationValue},
+			},
+		}
+	}
+	lockEvent := func(annotationValue string) {
+		controller.handleLockEvent(ctx, watch.Event{Type: watch.Modified, Object: newDaemonSet(annotationValue)})
+	}
+
+	// 2 of 4 nodes are allowed, maxOwners above the limit is only reported
+	lockEvent(`{"maxOwners":3,"locks":[` +
+		`{"nodeID":"kind-worker","created":"2024-05-31T06:30:00Z","TTL":0},` +
+		`{"nodeID":"kind-worker2","created":"2024-05-31T06:30:00Z","TTL":0}]}`)
+	require.Len(t, silencer.Silences(), 2)
+
+	// a third node would exceed the limit, the refusal is only recorded once per lock
+	for range 2 {
+		lockEvent(`{"maxOwners":3,"locks":[` +
+			`{"nodeID":"kind-worker","created":"2024-05-31T06:30:00Z","TTL":0},` +
+			`{"nodeID":"kind-worker2","created":"2024-05-31T06:30:00Z","TTL":0},` +
+			`{"nodeID":"kind-worker3","created":"2024-05-31T06:30:00Z","TTL":0}]}`)
+	}
+	require.Len(t, silencer.Silences(), 2)
+
+	// more holders than maxOwners means a malformed lock
+	lockEvent(`{"maxOwners":1,"locks":[` +
+		`{"nodeID":"kind-worker","created":"2024-05-31T06:30:00Z","TTL":0},` +
+		`{"nodeID":"kind-worker2","created":"2024-05-31T06:30:00Z","TTL":0}]}`)
+	require.Len(t, silencer.Silences(), 2)
+
+	events, err := controller.client.CoreV1().Events("kube-system").List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	reasons := []string{}
+	for _, event := range events.Items {
+		assert.Equal(t, corev1.EventTypeWarning, event.Type)
+		assert.Equal(t, "kured", event.InvolvedObject.Name)
+		assert.Equal(t, "DaemonSet", event.InvolvedObject.Kind)
+		reasons = append(reasons, event.Reason)
+	}
+	assert.ElementsMatch(t, []string{GuardReasonMaxOwnersAboveLimit, GuardReasonTooManyNodes, GuardReasonMaxOwnersExceeded}, reasons)
+
+	recorder := httptest.NewRecorder()
+	controller.MetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, recorder.Body.String(), "kured_alert_silencer_silenced_nodes 3\n")
+	assert.Contains(t, recorder.Body.String(), `kured_alert_silencer_guard_refusals_total{reason="LockHoldersAboveMaxOwners"} 1`+"\n")
+	assert.Contains(t, recorder.Body.String(), `kured_alert_silencer_guard_refusals_total{reason="TooManySilencedNodes"} 2`+"\n")
+
+	// the Nodes are listed again once the count expired
+	_, err = controller.client.CoreV1().Nodes().Create(ctx, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "kind-worker5"}}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = controller.client.CoreV1().Nodes().Create(ctx, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "kind-worker6"}}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	limit, err := controller.guardLimit(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, limit)
+	now = now.Add(guardNodeCountTTL)
+	limit, err = controller.guardLimit(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, limit)
+}
+
+func TestGuardRollingReboot(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	controller, silencer := newTestController(func() time.Time {
+		return now
+	})
+	controller.config.Guard = GuardConfig{MaxNodes: 2}
+	ctx := context.Background()
+
+	lockEvent := func(annotationValue string) {
+		controller.handleLockEvent(ctx, watch.Event{Type: watch.Modified, Object: &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{KuredNodeLockAnnotation: annotationValue}},
+		}})
+	}
+
+	// 5 minutes reboots 5 minutes apart overlap within their hour long silence windows, only the holder and the
+	// previous node in its lag window count
+	for i, nodeName := range []string{"kind-worker", "kind-worker2", "kind-worker3", "kind-worker4"} {
+		lockEvent(fmt.Sprintf(`{"maxOwners":1,"locks":[{"nodeID":%q,"created":%q,"TTL":0}]}`, nodeName, now.Format(time.RFC3339)))
+		require.Len(t, silencer.Silences(), i+1, nodeName)
+		now = now.Add(5 * time.Minute)
+		lockEvent(`{"maxOwners":1,"locks":[]}`)
+		now = now.Add(5 * time.Minute)
+	}
+}
+
+func TestGuardBroadMatchers(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	controller, silencer := newTestController(func() time.Time {
+		return now
+	})
+	controller.config.Silence.MatchersJSON = `[{"name": "instance", "value": "{{.NodeName}}.*", "isRegex": true}]`
+	controller.config.Silence.CanaryValues = []string{"prometheus-0"}
+	ctx := context.Background()
+
+	silenceNode := kured.SilenceNode{NodeID: "kind-worker", SilenceStart: now, SilenceEnd: now.Add(time.Hour)}
+	require.NoError(t, controller.silence(ctx, controller.config.Targets, controller.config.Silence, controller.nodeTemplateData(silenceNode), silenceNode.SilenceStart, silenceNode.SilenceEnd))
+
+	// the node name rendered empty
+	silenceNode.NodeID = ""
+	err := controller.silence(ctx, controller.config.Targets, controller.config.Silence, controller.nodeTemplateData(silenceNode), silenceNode.SilenceStart, silenceNode.SilenceEnd)
+	assert.ErrorIs(t, err, silence.ErrBroadMatchers)
+	assert.Len(t, silencer.Silences(), 1)
+	// refusals are not retried
+	assert.Zero(t, controller.retryQueue.len())
+
+	recorder := httptest.NewRecorder()
+	controller.MetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, recorder.Body.String(), `kured_alert_silencer_guard_refusals_total{reason="BroadSilenceMatchers"} 1`+"\n")
+}
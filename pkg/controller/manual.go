@@ -0,0 +1,159 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/trustyou/kured-alert-silencer/pkg/silence"
+)
+
+// ManualSilence is a silence of a node on a target handled by the silence command, Status is the change for create
+// and expire and the silence state for list
+type ManualSilence struct {
+	Target   string    `json:"target"`
+	Node     string    `json:"node,omitempty"`
+	Status   string    `json:"status"`
+	ID       string    `json:"id"`
+	Matchers string    `json:"matchers"`
+	StartsAt time.Time `json:"startsAt"`
+	EndsAt   time.Time `json:"endsAt"`
+}
+
+// ValidateSilence checks the templates of the node silences and the durations of their matcher groups
+func (c *Controller) ValidateSilence(minDuration time.Duration, maxDuration time.Duration) error {
+	return c.config.Silence.Validate(c.config.TemplateData, minDuration, maxDuration)
+}
+
+// manualTemplateData returns the template data of the silences of a node silenced by hand, the lock being taken now
+func (c *Controller) manualTemplateData(nodeName string, now time.Time) silence.TemplateData {
+	data := c.config.TemplateData
+	data.NodeName = nodeName
+	data.LockCreated = now
+	return data
+}
+
+// manualChanges returns the silences of the changes of a node on a target
+func manualChanges(target string, nodeName string, changes []silence.Change) []ManualSilence {
+	silences := []ManualSilence{}
+	for _, change := range changes {
+		silences = append(silences, ManualSilence{
+			Target:   target,
+			Node:     nodeName,
+			Status:   change.Action,
+			ID:       change.ID,
+			Matchers: change.MatchersString(),
+			StartsAt: change.StartsAt,
+			EndsAt:   change.EndsAt,
+		})
+	}
+	return silences
+}
+
+// manualSilences returns the listed silences of a node on a target
+func manualSilences(target string, nodeName string, listed []silence.Silence) []ManualSilence {
+	silences := []ManualSilence{}
+	for _, s := range listed {
+		silences = append(silences, ManualSilence{
+			Target:   target,
+			Node:     nodeName,
+			Status:   s.State,
+			ID:       s.ID,
+			Matchers: s.MatchersString(),
+			StartsAt: s.StartsAt,
+			EndsAt:   s.EndsAt,
+		})
+	}
+	return silences
+}
+
+// SilenceNodes creates the silences of the nodes on every target from now on for the duration, returning the
+// changes made along with every failure
+func (c *Controller) SilenceNodes(ctx context.Context, nodeNames []string, duration time.Duration) ([]ManualSilence, error) {
+	now := c.config.NowProvider()
+	silences := []ManualSilence{}
+	errs := []error{}
+	for _, target := range c.config.Targets {
+		for _, nodeName := range nodeNames {
+			data := c.manualTemplateData(nodeName, now)
+			tenantCtx, err := c.tenantContext(ctx, target, data)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: node %s: %w", target.Name, nodeName, err))
+				continue
+			}
+			changes, err := silence.SilenceAlerts(tenantCtx, target.Silencer, target.silenceConfig(c.config.Silence), data, now, now, now.Add(duration))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: node %s: %w", target.Name, nodeName, err))
+			}
+			silences = append(silences, manualChanges(target.Name, nodeName, changes)...)
+		}
+	}
+	return silences, errors.Join(errs...)
+}
+
+// ListSilences lists the active and pending silences of the nodes on every target, or every silence created by the
+// silence createdBy of every tenant without nodes
+func (c *Controller) ListSilences(ctx context.Context, nodeNames []string) ([]ManualSilence, error) {
+	now := c.config.NowProvider()
+	silences := []ManualSilence{}
+	errs := []error{}
+	for _, target := range c.config.Targets {
+		if len(nodeNames) == 0 {
+			tenants, err := c.targetTenants(ctx, target)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", target.Name, err))
+				continue
+			}
+			for _, tenant := range tenants {
+				created, err := silence.ListCreatedSilences(silence.WithTenant(ctx, tenant), target.Silencer, c.config.Silence.CreatedBy)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", target.Name, err))
+					continue
+				}
+				silences = append(silences, manualSilences(target.Name, "", created)...)
+			}
+			continue
+		}
+
+		for _, nodeName := range nodeNames {
+			data := c.manualTemplateData(nodeName, now)
+			tenantCtx, err := c.tenantContext(ctx, target, data)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: node %s: %w", target.Name, nodeName, err))
+				continue
+			}
+			created, err := silence.ListNodeSilences(tenantCtx, target.Silencer, target.silenceConfig(c.config.Silence), data)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: node %s: %w", target.Name, nodeName, err))
+				continue
+			}
+			silences = append(silences, manualSilences(target.Name, nodeName, created)...)
+		}
+	}
+	return silences, errors.Join(errs...)
+}
+
+// ExpireNodes expires the active and pending silences of the nodes on every target, returning the expired silences
+// along with every failure
+func (c *Controller) ExpireNodes(ctx context.Context, nodeNames []string) ([]ManualSilence, error) {
+	now := c.config.NowProvider()
+	silences := []ManualSilence{}
+	errs := []error{}
+	for _, target := range c.config.Targets {
+		for _, nodeName := range nodeNames {
+			data := c.manualTemplateData(nodeName, now)
+			tenantCtx, err := c.tenantContext(ctx, target, data)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: node %s: %w", target.Name, nodeName, err))
+				continue
+			}
+			expired, err := silence.ExpireNodeSilences(tenantCtx, target.Silencer, target.silenceConfig(c.config.Silence), data)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: node %s: %w", target.Name, nodeName, err))
+			}
+			silences = append(silences, manualChanges(target.Name, nodeName, expired)...)
+		}
+	}
+	return silences, errors.Join(errs...)
+}
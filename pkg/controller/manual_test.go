@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trustyou/kured-alert-silencer/pkg/silence"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestManualSilences(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	controller, silencer := newTestController(func() time.Time {
+		return now
+	})
+	controller.config.Silence.CreatedBy = silence.DefaultManualCreatedBy
+	ctx := context.Background()
+
+	// a silence of the silencer is neither listed nor expired
+	createSilences(t, silencer, now, silence.DefaultCreatedBy, []*models.Matcher{newMatcher("instance", "kind-worker3")})
+
+	created, err := controller.SilenceNodes(ctx, []string{"kind-worker", "kind-worker2"}, 30*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []ManualSilence{
+		{Target: "test", Node: "kind-worker", Status: silence.ChangeCreated, ID: "00000000-0000-0000-0000-000000000002", Matchers: `{instance="kind-worker"}`, StartsAt: now, EndsAt: now.Add(30 * time.Minute)},
+		{Target: "test", Node: "kind-worker2", Status: silence.ChangeCreated, ID: "00000000-0000-0000-0000-000000000003", Matchers: `{instance="kind-worker2"}`, StartsAt: now, EndsAt: now.Add(30 * time.Minute)},
+	}, created)
+	assert.Equal(t, silence.DefaultManualCreatedBy, silencer.Silences()[1].CreatedBy)
+
+	listed, err := controller.ListSilences(ctx, []string{"kind-worker"})
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Equal(t, "00000000-0000-0000-0000-000000000002", listed[0].ID)
+	assert.Equal(t, models.SilenceStatusStateActive, listed[0].Status)
+
+	// without nodes every silence created by the command is listed
+	listed, err = controller.ListSilences(ctx, nil)
+	require.NoError(t, err)
+	assert.Len(t, listed, 2)
+
+	expired, err := controller.ExpireNodes(ctx, []string{"kind-worker"})
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	assert.Equal(t, silence.ChangeExpired, expired[0].Status)
+	assert.Equal(t, "00000000-0000-0000-0000-000000000002", expired[0].ID)
+
+	listed, err = controller.ListSilences(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Equal(t, `{instance="kind-worker2"}`, listed[0].Matchers)
+	assert.Len(t, silencer.Silences(), 3)
+}
+
+func TestManualSilencesTenant(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	controller, _ := newTestController(func() time.Time {
+		return now
+	})
+	silencer := &tenantSilencer{FakeSilencer: silence.NewFakeSilencer(controller.config.NowProvider)}
+	controller.config.Targets = []Target{{Name: "mimir", Silencer: silencer, Tenant: `{{index .NodeLabels "example.com/tenant"}}`}}
+	ctx := context.Background()
+
+	_, err := controller.client.CoreV1().Nodes().Create(ctx, &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "kind-worker", Labels: map[string]string{"example.com/tenant": "team-a"}},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	_, err = controller.SilenceNodes(ctx, []string{"kind-worker"}, 30*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"team-a"}, silencer.tenants)
+
+	// the node labels can't be read without access to the cluster
+	controller.client = nil
+	_, err = controller.SilenceNodes(ctx, []string{"kind-worker"}, 30*time.Minute)
+	assert.ErrorIs(t, err, errNoClient)
+	_, err = controller.ListSilences(ctx, nil)
+	assert.ErrorIs(t, err, errNoClient)
+}
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"net/http"
+	"sync"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+)
+
+// metrics are the silencer metrics, exposed in the Prometheus exposition formats
+type metrics struct {
+	mu            sync.Mutex
+	silencedNodes int
+	guardRefusals map[string]int
+}
+
+func newMetrics() *metrics {
+	return &metrics{guardRefusals: map[string]int{}}
+}
+
+func (m *metrics) setSilencedNodes(silencedNodes int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.silencedNodes = silencedNodes
+}
+
+func (m *metrics) refused(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.guardRefusals[reason]++
+}
+
+// families returns the metric families of the silencer metrics
+func (m *metrics) families() []*dto.MetricFamily {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	refusals := []*dto.Metric{}
+	for _, reason := range []string{GuardReasonMaxOwnersExceeded, GuardReasonTooManyNodes, GuardReasonBroadMatchers, GuardReasonOutsideSchedule} {
+		refusals = append(refusals, &dto.Metric{
+			Label:   []*dto.LabelPair{{Name: proto.String("reason"), Value: proto.String(reason)}},
+			Counter: &dto.Counter{Value: proto.Float64(float64(m.guardRefusals[reason]))},
+		})
+	}
+
+	return []*dto.MetricFamily{
+		{
+			Name:   proto.String("kured_alert_silencer_silenced_nodes"),
+			Help:   proto.String("Nodes silenced simultaneously, as counted by the blast-radius guard."),
+			Type:   dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: proto.Float64(float64(m.silencedNodes))}}},
+		},
+		{
+			Name:   proto.String("kured_alert_silencer_guard_refusals_total"),
+			Help:   proto.String("Silences refused by the blast-radius guard, for too broad matchers or outside of the schedule."),
+			Type:   dto.MetricType_COUNTER.Enum(),
+			Metric: refusals,
+		},
+	}
+}
+
+// ServeHTTP encodes the metrics in the exposition format negotiated with the scraper
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	format := expfmt.Negotiate(r.Header)
+	w.Header().Set("Content-Type", string(format))
+	encoder := expfmt.NewEncoder(w, format)
+	for _, family := range m.families() {
+		if err := encoder.Encode(family); err != nil {
+			log.WithError(err).Error("failed to encode metrics")
+			return
+		}
+	}
+}
+
+// MetricsHandler serves the silencer metrics in the Prometheus exposition formats
+func (c *Controller) MetricsHandler() http.Handler {
+	return c.metrics
+}
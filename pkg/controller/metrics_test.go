@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	metrics := newMetrics()
+	metrics.setSilencedNodes(2)
+	metrics.refused(GuardReasonTooManyNodes)
+	metrics.refused(GuardReasonTooManyNodes)
+	metrics.refused(GuardReasonOutsideSchedule)
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, expfmt.TypeTextPlain, expfmt.ResponseFormat(recorder.Header()).FormatType())
+
+	// the output is read back by the Prometheus parser
+	parser := expfmt.NewTextParser(model.UTF8Validation)
+	families, err := parser.TextToMetricFamilies(recorder.Body)
+	require.NoError(t, err)
+	require.Len(t, families, 2)
+
+	silencedNodes := families["kured_alert_silencer_silenced_nodes"]
+	require.NotNil(t, silencedNodes)
+	assert.Equal(t, dto.MetricType_GAUGE, silencedNodes.GetType())
+	assert.Equal(t, 2.0, silencedNodes.GetMetric()[0].GetGauge().GetValue())
+
+	refusals := families["kured_alert_silencer_guard_refusals_total"]
+	require.NotNil(t, refusals)
+	assert.Equal(t, dto.MetricType_COUNTER, refusals.GetType())
+	byReason := map[string]float64{}
+	for _, metric := range refusals.GetMetric() {
+		require.Len(t, metric.GetLabel(), 1)
+		byReason[metric.GetLabel()[0].GetValue()] = metric.GetCounter().GetValue()
+	}
+	assert.Equal(t, map[string]float64{
+		GuardReasonMaxOwnersExceeded: 0,
+		GuardReasonTooManyNodes:      2,
+		GuardReasonBroadMatchers:     0,
+		GuardReasonOutsideSchedule:   1,
+	}, byReason)
+}
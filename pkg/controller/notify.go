@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"github.com/trustyou/kured-alert-silencer/pkg/silence"
+	"github.com/trustyou/kured-alert-silencer/pkg/webhook"
+)
+
+// notify sends one event per action of the silence changes of a node on a target, and a failed event on error
+func (c *Controller) notify(target Target, nodeName string, changes []silence.Change, err error) {
+	if c.config.Notifier == nil {
+		return
+	}
+
+	events := map[string]*webhook.Event{}
+	order := []string{}
+	for _, change := range changes {
+		event, ok := events[change.Action]
+		if !ok {
+			event = c.newEvent(change.Action, target, nodeName)
+			events[change.Action] = event
+			order = append(order, change.Action)
+		}
+		event.Matchers = append(event.Matchers, change.MatchersString())
+		event.SilenceIDs = append(event.SilenceIDs, change.ID)
+		if event.StartsAt.IsZero() || change.StartsAt.Before(event.StartsAt) {
+			event.StartsAt = change.StartsAt
+		}
+		if change.EndsAt.After(event.EndsAt) {
+			event.EndsAt = change.EndsAt
+		}
+	}
+	for _, action := range order {
+		c.config.Notifier.Notify(*events[action])
+	}
+
+	if err != nil {
+		event := c.newEvent(webhook.EventFailed, target, nodeName)
+		event.Error = err.Error()
+		c.config.Notifier.Notify(*event)
+	}
+}
+
+func (c *Controller) newEvent(action string, target Target, nodeName string) *webhook.Event {
+	return &webhook.Event{
+		Event:      action,
+		Cluster:    c.config.TemplateData.ClusterName,
+		Target:     target.Name,
+		Node:       nodeName,
+		Matchers:   []string{},
+		SilenceIDs: []string{},
+		Time:       c.config.NowProvider(),
+	}
+}
@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trustyou/kured-alert-silencer/pkg/kured"
+	"github.com/trustyou/kured-alert-silencer/pkg/silence"
+	"github.com/trustyou/kured-alert-silencer/pkg/webhook"
+)
+
+type fakeNotifier struct {
+	mu     sync.Mutex
+	events []webhook.Event
+}
+
+func (f *fakeNotifier) Notify(event webhook.Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, event)
+}
+
+func TestNotify(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	var elapsed time.Duration
+	controller, silencer := newTestController(func() time.Time {
+		return now.Add(elapsed)
+	})
+	notifier := &fakeNotifier{}
+	controller.config.Notifier = notifier
+	ctx := context.Background()
+
+	silenceNode := kured.SilenceNode{NodeID: "kind-worker", SilenceStart: now, SilenceEnd: now.Add(time.Hour)}
+	require.NoError(t, controller.silence(ctx, controller.config.Targets, controller.config.Silence, controller.nodeTemplateData(silenceNode), silenceNode.SilenceStart, silenceNode.SilenceEnd))
+	silenceNode.SilenceEnd = now.Add(2 * time.Hour)
+	require.NoError(t, controller.silence(ctx, controller.config.Targets, controller.config.Silence, controller.nodeTemplateData(silenceNode), silenceNode.SilenceStart, silenceNode.SilenceEnd))
+	silencer.SetError(errors.New("unavailable"))
+	require.Error(t, controller.silence(ctx, controller.config.Targets, controller.config.Silence, controller.nodeTemplateData(silenceNode), silenceNode.SilenceStart, silenceNode.SilenceEnd))
+	// the failure is only notified once per request, not when requested again nor on each retry
+	require.Error(t, controller.silence(ctx, controller.config.Targets, controller.config.Silence, controller.nodeTemplateData(silenceNode), silenceNode.SilenceStart, silenceNode.SilenceEnd))
+	elapsed = time.Minute
+	controller.retry(ctx)
+	require.Equal(t, 1, controller.retryQueue.len())
+	silencer.SetError(nil)
+	controller.retryQueue.succeeded(retryItem{target: controller.config.Targets[0], silenceConfig: controller.config.Silence, data: controller.nodeTemplateData(silenceNode)})
+	elapsed = 0
+
+	createSilences(t, silencer, now, silence.DefaultCreatedBy, []*models.Matcher{newMatcher("instance", "kind-worker2")})
+	require.NoError(t, controller.CleanupOrphanedSilences(ctx))
+
+	require.Len(t, notifier.events, 4)
+	assert.Equal(t, webhook.Event{
+		Event:      webhook.EventCreated,
+		Cluster:    "test",
+		Target:     "test",
+		Node:       "kind-worker",
+		Matchers:   []string{`{instance="kind-worker"}`},
+		StartsAt:   now,
+		EndsAt:     now.Add(time.Hour),
+		SilenceIDs: []string{"00000000-0000-0000-0000-000000000001"},
+		Time:       now,
+	}, notifier.events[0])
+	assert.Equal(t, webhook.EventExtended, notifier.events[1].Event)
+	assert.Equal(t, []string{"00000000-0000-0000-0000-000000000002"}, notifier.events[1].SilenceIDs)
+	assert.Equal(t, webhook.EventFailed, notifier.events[2].Event)
+	assert.Contains(t, notifier.events[2].Error, "unavailable")
+
+	// the cleanup expires every silence as no node is rebooting
+	assert.Equal(t, webhook.EventExpired, notifier.events[3].Event)
+	assert.Empty(t, notifier.events[3].Node)
+	assert.Equal(t, []string{
+		"00000000-0000-0000-0000-000000000001",
+		"00000000-0000-0000-0000-000000000002",
+		"00000000-0000-0000-0000-000000000003",
+	}, notifier.events[3].SilenceIDs)
+}
@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/trustyou/kured-alert-silencer/pkg/kured"
+	"github.com/trustyou/kured-alert-silencer/pkg/silence"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+const (
+	// PodSilenceModePod creates silences for each pod running on the rebooted node
+	PodSilenceModePod = "pod"
+	// PodSilenceModeWorkload creates silences for each workload owning pods on the rebooted node, the pods of
+	// DaemonSets and static pods are silenced one by one as their workload runs on every node
+	PodSilenceModeWorkload = "workload"
+
+	// DefaultPodMatchersJSON silences the alerts of a pod
+	DefaultPodMatchersJSON = `[{"matchers": [{"name": "namespace", "value": "{{.Namespace}}", "isRegex": false}, {"name": "pod", "value": "{{.Pod}}", "isRegex": false}]}]`
+	// DefaultWorkloadMatchersJSON silences the alerts of a workload and of its pods, using kube-state-metrics labels
+	DefaultWorkloadMatchersJSON = `[{"matchers": [{"name": "namespace", "value": "{{.Namespace}}", "isRegex": false}, {"name": "{{.WorkloadLabel}}", "value": "{{.WorkloadName}}", "isRegex": false}]}, ` +
+		`{"matchers": [{"name": "namespace", "value": "{{.Namespace}}", "isRegex": false}, {"name": "pod", "value": "{{quoteRegex .WorkloadName}}{{.PodNameSuffix}}", "isRegex": true}]}]`
+
+	// generatedCharacters are the characters of the random suffixes and hashes of the generated names
+	generatedCharacters = "[bcdfghjklmnpqrstvwxz2456789]"
+)
+
+// workloadLabels are the kube-state-metrics labels naming the workloads whose label is not their lower case kind, the
+// job label being the Prometheus scrape job
+var workloadLabels = map[string]string{"job": "job_name"}
+
+// podNameSuffixes are the regexes of what follows the workload name in the names of its pods by lower case kind, the
+// pods of the other kinds having a random suffix, e.g. the pods of a Job or a ReplicaSet
+var podNameSuffixes = map[string]string{
+	// the hash of the pod template then a random suffix
+	"deployment":  "-" + generatedCharacters + "+-" + generatedCharacters + "{5}",
+	"statefulset": "-[0-9]+",
+	// the pod itself
+	"pod": "",
+}
+
+// PodSilenceConfig holds the settings of the silences created for the pods running on a rebooted node
+type PodSilenceConfig struct {
+	// Mode is PodSilenceModePod or PodSilenceModeWorkload, disabled when empty
+	Mode string
+	// MatchersJSON uses the pod fields of the template data, the comment and createdBy are the node silence ones
+	MatchersJSON string
+	// Exclusions replace the node silence exclusions
+	Exclusions []*models.Matcher
+}
+
+// nodeLocalKinds are the owners of pods bound to a node, silencing them would silence their pods on every node
+var nodeLocalKinds = map[string]bool{"DaemonSet": true, "Node": true}
+
+// workload identifies the object owning a pod, with the lower case kind used by kube-state-metrics labels
+type workload struct {
+	namespace string
+	kind      string
+	name      string
+}
+
+// label returns the kube-state-metrics label naming the workload
+func (w workload) label() string {
+	if label, ok := workloadLabels[w.kind]; ok {
+		return label
+	}
+	return w.kind
+}
+
+// podNameSuffix returns the regex of what follows the workload name in the names of its pods
+func (w workload) podNameSuffix() string {
+	if suffix, ok := podNameSuffixes[w.kind]; ok {
+		return suffix
+	}
+	return "-" + generatedCharacters + "{5}"
+}
+
+// podTemplateData lists the pods scheduled on the node and returns the template data of each pod, or of each workload
+func (c *Controller) podTemplateData(ctx context.Context, silenceNode kured.SilenceNode) ([]silence.TemplateData, error) {
+	nodeName := silenceNode.NodeID
+	pods, err := c.client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	templateData := []silence.TemplateData{}
+	seen := map[workload]bool{}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName != nodeName || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+
+		owner := c.podWorkload(ctx, &pod)
+		if c.config.Pods.Mode == PodSilenceModeWorkload {
+			if seen[owner] {
+				continue
+			}
+			seen[owner] = true
+		}
+
+		data := c.nodeTemplateData(silenceNode)
+		data.Namespace = pod.Namespace
+		data.Pod = pod.Name
+		data.WorkloadKind = owner.kind
+		data.WorkloadName = owner.name
+		data.WorkloadLabel = owner.label()
+		data.PodNameSuffix = owner.podNameSuffix()
+		templateData = append(templateData, data)
+	}
+	return templateData, nil
+}
+
+// podWorkload resolves the workload owning a pod, following ReplicaSets up to their Deployment. Pods without owner or
+// owned by a node-local workload are their own workload
+func (c *Controller) podWorkload(ctx context.Context, pod *corev1.Pod) workload {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || nodeLocalKinds[owner.Kind] {
+		return workload{namespace: pod.Namespace, kind: "pod", name: pod.Name}
+	}
+
+	if owner.Kind == "ReplicaSet" {
+		replicaSet, err := c.client.AppsV1().ReplicaSets(pod.Namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+		if err != nil {
+			log.WithError(err).Debugf("failed to get ReplicaSet %s/%s", pod.Namespace, owner.Name)
+		} else if deployment := metav1.GetControllerOf(replicaSet); deployment != nil {
+			owner = deployment
+		}
+	}
+
+	return workload{namespace: pod.Namespace, kind: strings.ToLower(owner.Kind), name: owner.Name}
+}
+
+// podSilenceConfig returns the node silence settings with the pod matchers and exclusions
+func (c Config) podSilenceConfig() silence.Config {
+	silenceConfig := c.Silence
+	silenceConfig.MatchersJSON = c.Pods.MatchersJSON
+	silenceConfig.Exclusions = c.Pods.Exclusions
+	return silenceConfig
+}
+
+// silencePods silences the alerts of the pods running on the node for the node silence window, failing when the pods
+// can't be listed. The silences failing on target errors are retried on their own
+func (c *Controller) silencePods(ctx context.Context, silenceNode kured.SilenceNode) error {
+	templateData, err := c.podTemplateData(ctx, silenceNode)
+	if err != nil {
+		return fmt.Errorf("failed to list pods of node %s: %w", silenceNode.NodeID, err)
+	}
+
+	silenceConfig := c.config.podSilenceConfig()
+
+	log.Infof("silencing alerts for %d %ss of node %s", len(templateData), c.config.Pods.Mode, silenceNode.NodeID)
+	for _, data := range templateData {
+		err := c.silence(ctx, c.alertTargets(), silenceConfig, data, silenceNode.SilenceStart, silenceNode.SilenceEnd)
+		if err != nil {
+			log.WithError(err).Errorf("failed to silence alerts for pod %s/%s", data.Namespace, data.Pod)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trustyou/kured-alert-silencer/pkg/kured"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newPod(name string, nodeName string, phase corev1.PodPhase, owner *metav1.OwnerReference) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       corev1.PodSpec{NodeName: nodeName},
+		Status:     corev1.PodStatus{Phase: phase},
+	}
+	if owner != nil {
+		pod.OwnerReferences = []metav1.OwnerReference{*owner}
+	}
+	return pod
+}
+
+func controllerRef(kind string, name string) *metav1.OwnerReference {
+	isController := true
+	return &metav1.OwnerReference{Kind: kind, Name: name, Controller: &isController}
+}
+
+func podObjects() []runtime.Object {
+	replicaSet := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "web-6d4cf56db6",
+			Namespace:       "default",
+			OwnerReferences: []metav1.OwnerReference{*controllerRef("Deployment", "web")},
+		},
+	}
+
+	return []runtime.Object{
+		replicaSet,
+		newPod("web-6d4cf56db6-bcdfg", "kind-worker", corev1.PodRunning, controllerRef("ReplicaSet", "web-6d4cf56db6")),
+		newPod("web-6d4cf56db6-hjklm", "kind-worker", corev1.PodRunning, controllerRef("ReplicaSet", "web-6d4cf56db6")),
+		newPod("db-0", "kind-worker", corev1.PodRunning, controllerRef("StatefulSet", "db")),
+		newPod("debug", "kind-worker", corev1.PodPending, nil),
+		newPod("node-exporter-x7k2p", "kind-worker", corev1.PodRunning, controllerRef("DaemonSet", "node-exporter")),
+		newPod("migration-xyz", "kind-worker", corev1.PodSucceeded, controllerRef("Job", "migration")),
+		newPod("backup-28512345-x7k2p", "kind-worker", corev1.PodRunning, controllerRef("Job", "backup-28512345")),
+		newPod("web-6d4cf56db6-npqrs", "kind-worker2", corev1.PodRunning, controllerRef("ReplicaSet", "web-6d4cf56db6")),
+	}
+}
+
+func TestPodTemplateData(t *testing.T) {
+	tests := []struct {
+		name string
+		mode string
+		want [][]string
+	}{
+		{
+			name: "pod mode",
+			mode: PodSilenceModePod,
+			want: [][]string{
+				{"web-6d4cf56db6-bcdfg", "deployment", "web"},
+				{"web-6d4cf56db6-hjklm", "deployment", "web"},
+				{"db-0", "statefulset", "db"},
+				{"debug", "pod", "debug"},
+				{"node-exporter-x7k2p", "pod", "node-exporter-x7k2p"},
+				{"backup-28512345-x7k2p", "job", "backup-28512345"},
+			},
+		},
+		{
+			name: "workload mode",
+			mode: PodSilenceModeWorkload,
+			want: [][]string{
+				{"web-6d4cf56db6-bcdfg", "deployment", "web"},
+				{"db-0", "statefulset", "db"},
+				{"debug", "pod", "debug"},
+				{"node-exporter-x7k2p", "pod", "node-exporter-x7k2p"},
+				{"backup-28512345-x7k2p", "job", "backup-28512345"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controller := New(fake.NewSimpleClientset(podObjects()...), Config{Pods: PodSilenceConfig{Mode: tt.mode}})
+
+			templateData, err := controller.podTemplateData(context.Background(), kured.SilenceNode{NodeID: "kind-worker"})
+			require.NoError(t, err)
+
+			result := [][]string{}
+			for _, data := range templateData {
+				assert.Equal(t, "kind-worker", data.NodeName)
+				assert.Equal(t, "default", data.Namespace)
+				result = append(result, []string{data.Pod, data.WorkloadKind, data.WorkloadName})
+			}
+			assert.ElementsMatch(t, tt.want, result)
+		})
+	}
+}
+
+func TestHandleLockEventPods(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	controller, silencer := newTestController(func() time.Time {
+		return now
+	})
+	controller.client = fake.NewSimpleClientset(podObjects()...)
+	controller.config.Pods = PodSilenceConfig{Mode: PodSilenceModeWorkload, MatchersJSON: DefaultWorkloadMatchersJSON}
+
+	event := watch.Event{
+		Type: watch.Modified,
+		Object: &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{
+					KuredNodeLockAnnotation: `{"nodeID":"kind-worker","metadata":{"unschedulable":false},"created":"2024-05-31T06:31:00Z","TTL":0}`,
+				},
+			},
+		},
+	}
+
+	// one node silence and two silences for each of the five workloads, the DaemonSet pod being its own workload
+	controller.handleLockEvent(context.Background(), event)
+	silences := silencer.Silences()
+	require.Len(t, silences, 11)
+	silenced := []string{}
+	for _, s := range silences[1:] {
+		matchers := []string{}
+		for _, matcher := range s.Matchers {
+			matchers = append(matchers, *matcher.Name+"="+*matcher.Value)
+		}
+		silenced = append(silenced, strings.Join(matchers, ","))
+		assert.Equal(t, time.Date(2024, time.May, 31, 7, 31, 0, 0, time.UTC), s.EndsAt)
+	}
+	assert.Contains(t, silenced, "namespace=default,deployment=web")
+	assert.Contains(t, silenced, "namespace=default,pod=web-[bcdfghjklmnpqrstvwxz2456789]+-[bcdfghjklmnpqrstvwxz2456789]{5}")
+	assert.Contains(t, silenced, "namespace=default,statefulset=db")
+	assert.Contains(t, silenced, "namespace=default,pod=db-[0-9]+")
+	// kube-state-metrics names the Job of a pod with job_name, job being the scrape job
+	assert.Contains(t, silenced, "namespace=default,job_name=backup-28512345")
+	assert.Contains(t, silenced, "namespace=default,pod=backup-28512345-[bcdfghjklmnpqrstvwxz2456789]{5}")
+	assert.Contains(t, silenced, "namespace=default,pod=debug")
+	assert.Contains(t, silenced, "namespace=default,pod=node-exporter-x7k2p")
+	assert.NotContains(t, silenced, "namespace=default,daemonset=node-exporter")
+
+	// pods are only listed once per lock, only the expired node silence is created again
+	for _, s := range silences {
+		require.NoError(t, silencer.ExpireSilence(context.Background(), s.ID))
+	}
+	controller.handleLockEvent(context.Background(), event)
+	silences = silencer.Silences()
+	require.Len(t, silences, 12)
+	assert.Equal(t, "kind-worker", *silences[11].Matchers[0].Value)
+}
+
+func TestHandleLockEventPodsListFailure(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	controller, silencer := newTestController(func() time.Time {
+		return now
+	})
+	client := fake.NewSimpleClientset(podObjects()...)
+	listErr := errors.New("connection refused")
+	client.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if listErr != nil {
+			return true, nil, listErr
+		}
+		return false, nil, nil
+	})
+	controller.client = client
+	controller.config.Pods = PodSilenceConfig{Mode: PodSilenceModePod, MatchersJSON: DefaultPodMatchersJSON}
+
+	event := watch.Event{
+		Type: watch.Modified,
+		Object: &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{
+					KuredNodeLockAnnotation: `{"nodeID":"kind-worker","created":"2024-05-31T06:31:00Z","TTL":0}`,
+				},
+			},
+		},
+	}
+
+	// only the node is silenced while the pods can't be listed
+	controller.handleLockEvent(context.Background(), event)
+	require.Len(t, silencer.Silences(), 1)
+
+	// the pods are silenced on the next lock event
+	listErr = nil
+	controller.handleLockEvent(context.Background(), event)
+	require.Len(t, silencer.Silences(), 7)
+}
+
+func TestPodNameSuffix(t *testing.T) {
+	tests := []struct {
+		name     string
+		workload workload
+		pod      string
+		want     bool
+	}{
+		{"Deployment pod", workload{kind: "deployment", name: "web"}, "web-6d4cf56db6-bcdfg", true},
+		{"Deployment with the same prefix", workload{kind: "deployment", name: "web"}, "web-api-6d4cf56db6-bcdfg", false},
+		{"StatefulSet pod", workload{kind: "statefulset", name: "db"}, "db-12", true},
+		{"StatefulSet with the same prefix", workload{kind: "statefulset", name: "db"}, "db-backup-0", false},
+		{"Job pod", workload{kind: "job", name: "backup"}, "backup-x7k2p", true},
+		{"Job with the same prefix", workload{kind: "job", name: "backup"}, "backup-db-x7k2p", false},
+		{"Pod", workload{kind: "pod", name: "debug"}, "debug", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			re := regexp.MustCompile("^(?:" + regexp.QuoteMeta(tt.workload.name) + tt.workload.podNameSuffix() + ")$")
+			assert.Equal(t, tt.want, re.MatchString(tt.pod))
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/trustyou/kured-alert-silencer/pkg/silence"
+)
+
+const (
+	// DefaultRetryBaseDelay is the delay before the first retry when none is configured
+	DefaultRetryBaseDelay = time.Second
+	// DefaultRetryMaxDelay caps the delay between two retries when none is configured
+	DefaultRetryMaxDelay = 5 * time.Minute
+)
+
+// RetryConfig holds the exponential backoff of the silences failing on target errors
+type RetryConfig struct {
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// retryKey identifies a silence request, a newer request for the same key replaces the queued one
+type retryKey struct {
+	target       string
+	matchersJSON string
+	nodeName     string
+	namespace    string
+	pod          string
+}
+
+// retryItem is a silence request waiting for its next attempt
+type retryItem struct {
+	target        Target
+	silenceConfig silence.Config
+	data          silence.TemplateData
+	start         time.Time
+	end           time.Time
+	attempts      int
+	next          time.Time
+}
+
+// retryQueue holds the failed silence requests, it belongs to the controller so it survives watch restarts
+type retryQueue struct {
+	config RetryConfig
+	// jitter returns a random duration in [0, max)
+	jitter func(max time.Duration) time.Duration
+
+	mu    sync.Mutex
+	items map[retryKey]*retryItem
+}
+
+func newRetryQueue(config RetryConfig) *retryQueue {
+	return &retryQueue{
+		config: config,
+		jitter: func(max time.Duration) time.Duration {
+			if max <= 0 {
+				return 0
+			}
+			return rand.N(max)
+		},
+		items: map[retryKey]*retryItem{},
+	}
+}
+
+func newRetryKey(target Target, silenceConfig silence.Config, data silence.TemplateData) retryKey {
+	return retryKey{
+		target:       target.Name,
+		matchersJSON: silenceConfig.MatchersJSON,
+		nodeName:     data.NodeName,
+		namespace:    data.Namespace,
+		pod:          data.Pod,
+	}
+}
+
+// backoff returns the delay before the given attempt, doubling from the base delay up to the max delay,
+// half of it being random to spread the retries
+func (q *retryQueue) backoff(attempts int) time.Duration {
+	delay := q.config.BaseDelay
+	for i := 1; i < attempts && delay < q.config.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > q.config.MaxDelay {
+		delay = q.config.MaxDelay
+	}
+	return delay/2 + q.jitter(delay/2)
+}
+
+// failed queues the silence request for a retry, keeping the attempts of the queued request with the same key. It
+// reports whether this is the first failure of the request, neither a retry nor already queued
+func (q *retryQueue) failed(item retryItem, now time.Time) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	first := item.attempts == 0
+	key := newRetryKey(item.target, item.silenceConfig, item.data)
+	if queued, ok := q.items[key]; ok {
+		first = false
+		if queued.attempts > item.attempts {
+			item.attempts = queued.attempts
+		}
+	}
+	item.attempts++
+	item.next = now.Add(q.backoff(item.attempts))
+	q.items[key] = &item
+	return first
+}
+
+// succeeded removes the queued silence request with the same key
+func (q *retryQueue) succeeded(item retryItem) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.items, newRetryKey(item.target, item.silenceConfig, item.data))
+}
+
+// due removes and returns the silence requests to retry, dropping the ones whose silence already ended
+func (q *retryQueue) due(now time.Time) []retryItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items := []retryItem{}
+	for key, item := range q.items {
+		if !item.end.After(now) {
+			log.Warnf("giving up silencing alerts for node %s on %s after %d attempts, the silence already ended", item.data.NodeName, item.target.Name, item.attempts)
+			delete(q.items, key)
+			continue
+		}
+		if item.next.After(now) {
+			continue
+		}
+		items = append(items, *item)
+		delete(q.items, key)
+	}
+	return items
+}
+
+// len returns the number of queued silence requests
+func (q *retryQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.items)
+}
+
+// alertTargets returns the targets silencing alerts by their matchers, without the maintenance targets
+func (c *Controller) alertTargets() []Target {
+	targets := []Target{}
+	for _, target := range c.config.Targets {
+		if !target.Maintenance {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// silence creates the silences on the given targets, queueing them for a retry with backoff when a target fails
+func (c *Controller) silence(ctx context.Context, targets []Target, silenceConfig silence.Config, data silence.TemplateData, start time.Time, end time.Time) error {
+	errs := []error{}
+	for _, target := range targets {
+		err := c.attempt(ctx, retryItem{target: target, silenceConfig: silenceConfig, data: data, start: start, end: end})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", target.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// retryable reports whether a failed silence request is worth retrying: retryable target errors and node labels that
+// could not be read for the tenant
+func retryable(err error) bool {
+	return errors.Is(err, silence.ErrRetryable) || errors.Is(err, errNodeLabels)
+}
+
+// attempt creates the silences of a request on its target, queueing the request again when the target fails. Only
+// the first failure of a request is notified, not every retry
+func (c *Controller) attempt(ctx context.Context, item retryItem) error {
+	var changes []silence.Change
+	tenantCtx, err := c.tenantContext(ctx, item.target, item.data)
+	if err == nil {
+		changes, err = silence.SilenceAlerts(tenantCtx, item.target.Silencer, item.target.silenceConfig(item.silenceConfig), item.data, c.config.NowProvider(), item.start, item.end)
+	}
+	if errors.Is(err, silence.ErrBroadMatchers) {
+		c.metrics.refused(GuardReasonBroadMatchers)
+	}
+
+	notifyErr := err
+	if retryable(err) {
+		if !c.retryQueue.failed(item, c.config.NowProvider()) {
+			notifyErr = nil
+		}
+	} else {
+		c.retryQueue.succeeded(item)
+	}
+	c.notify(item.target, item.data.NodeName, changes, notifyErr)
+	return err
+}
+
+// retry attempts the queued silence requests that are due
+func (c *Controller) retry(ctx context.Context) {
+	for _, item := range c.retryQueue.due(c.config.NowProvider()) {
+		log.Infof("retrying silencing alerts for node %s on %s, attempt %d", item.data.NodeName, item.target.Name, item.attempts+1)
+		if err := c.attempt(ctx, item); err != nil {
+			log.WithError(err).Errorf("failed to silence alerts for node %s on %s", item.data.NodeName, item.target.Name)
+		}
+	}
+}
+
+// watchRetries periodically retries the failed silence requests
+func (c *Controller) watchRetries(ctx context.Context, workCtx context.Context) {
+	ticker := time.NewTicker(c.config.Retry.BaseDelay)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.retry(workCtx)
+		}
+	}
+}
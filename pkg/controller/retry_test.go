@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trustyou/kured-alert-silencer/pkg/kured"
+	"github.com/trustyou/kured-alert-silencer/pkg/silence"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestRetryQueueBackoff(t *testing.T) {
+	queue := newRetryQueue(RetryConfig{BaseDelay: time.Second, MaxDelay: 10 * time.Second})
+
+	tests := []struct {
+		attempts int
+		jitter   time.Duration
+		want     time.Duration
+	}{
+		{attempts: 1, want: 500 * time.Millisecond},
+		{attempts: 1, jitter: 300 * time.Millisecond, want: 800 * time.Millisecond},
+		{attempts: 2, want: time.Second},
+		{attempts: 4, want: 4 * time.Second},
+		{attempts: 5, want: 5 * time.Second},
+		{attempts: 50, jitter: time.Second, want: 6 * time.Second},
+	}
+
+	for _, tt := range tests {
+		queue.jitter = func(max time.Duration) time.Duration {
+			return tt.jitter
+		}
+		assert.Equal(t, tt.want, queue.backoff(tt.attempts), "attempts %d", tt.attempts)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	controller, silencer := newTestController(func() time.Time {
+		return now
+	})
+	controller.retryQueue.jitter = func(max time.Duration) time.Duration {
+		return 0
+	}
+	silencer.SetError(errors.New("unavailable"))
+
+	controller.handleLockEvent(context.Background(), watch.Event{
+		Type: watch.Modified,
+		Object: &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{KuredNodeLockAnnotation: `{"nodeID":"kind-worker","metadata":{"unschedulable":false},"created":"2024-05-31T06:31:00Z","TTL":0}`},
+			},
+		},
+	})
+	require.Empty(t, silencer.Silences())
+	require.Equal(t, 1, controller.retryQueue.len())
+
+	// not due yet
+	controller.retry(context.Background())
+	require.Equal(t, 1, controller.retryQueue.len())
+
+	// still failing, the next retry is scheduled later
+	now = now.Add(500 * time.Millisecond)
+	controller.retry(context.Background())
+	require.Equal(t, 1, controller.retryQueue.len())
+	for _, item := range controller.retryQueue.items {
+		assert.Equal(t, 2, item.attempts)
+		assert.Equal(t, now.Add(time.Second), item.next)
+	}
+
+	silencer.SetError(nil)
+	now = now.Add(time.Second)
+	controller.retry(context.Background())
+	require.Len(t, silencer.Silences(), 1)
+	assert.Equal(t, "kind-worker", *silencer.Silences()[0].Matchers[0].Value)
+	assert.Equal(t, 0, controller.retryQueue.len())
+
+	// silences that already ended are not retried
+	silencer.SetError(errors.New("unavailable"))
+	controller.silenceNode(context.Background(), controller.config.Targets, controller.config.Silence, kured.SilenceNode{NodeID: "kind-worker2", SilenceStart: now, SilenceEnd: now.Add(time.Hour)})
+	require.Equal(t, 1, controller.retryQueue.len())
+	now = now.Add(2 * time.Hour)
+	silencer.SetError(nil)
+	controller.retry(context.Background())
+	require.Len(t, silencer.Silences(), 1)
+	assert.Equal(t, 0, controller.retryQueue.len())
+}
+
+func TestRetryPerTarget(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	controller, silencer := newTestController(func() time.Time {
+		return now
+	})
+	controller.retryQueue.jitter = func(max time.Duration) time.Duration {
+		return 0
+	}
+	failing := silence.NewFakeSilencer(controller.config.NowProvider)
+	failing.SetError(errors.New("unavailable"))
+	controller.config.Targets = append(controller.config.Targets, Target{Name: "failing", Silencer: failing})
+
+	silenceNode := kured.SilenceNode{NodeID: "kind-worker", SilenceStart: now, SilenceEnd: now.Add(time.Hour)}
+	err := controller.silence(context.Background(), controller.config.Targets, controller.config.Silence, controller.nodeTemplateData(silenceNode), silenceNode.SilenceStart, silenceNode.SilenceEnd)
+	require.ErrorContains(t, err, "failing: ")
+	require.Len(t, silencer.Silences(), 1)
+	require.Equal(t, 1, controller.retryQueue.len())
+
+	// only the failing target is retried
+	failing.SetError(nil)
+	now = now.Add(time.Second)
+	controller.retry(context.Background())
+	require.Len(t, silencer.Silences(), 1)
+	require.Len(t, failing.Silences(), 1)
+	assert.Equal(t, 0, controller.retryQueue.len())
+}
@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/trustyou/kured-alert-silencer/pkg/kured"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// GuardReasonOutsideSchedule is the reason of the refusals of reboots started outside the maintenance schedule
+	GuardReasonOutsideSchedule = "RebootOutsideSchedule"
+
+	// DefaultScheduleDays, DefaultScheduleStartTime and DefaultScheduleEndTime are the kured defaults, every time
+	DefaultScheduleDays      = "su,mo,tu,we,th,fr,sa"
+	DefaultScheduleStartTime = "0:00"
+	DefaultScheduleEndTime   = "23:59:59"
+)
+
+// Schedule is the maintenance window of the reboots, matching the kured --reboot-days, --start-time, --end-time and
+// --time-zone flags. Reboots started outside of it are unusual and not silenced
+type Schedule struct {
+	// Days are indexed by time.Weekday
+	Days [7]bool
+	// Start and End are the times of day of the window, which spans midnight when End is before Start
+	Start    time.Duration
+	End      time.Duration
+	Location *time.Location
+}
+
+// ParseSchedule parses a schedule in the kured format: comma-separated days like "mo,tu" or "monday", times of day
+// like "22:00" or "6:30:00" and a time zone like "UTC", "Local" or "Europe/Berlin"
+func ParseSchedule(days string, startTime string, endTime string, timeZone string) (*Schedule, error) {
+	schedule := &Schedule{}
+	for _, day := range strings.Split(days, ",") {
+		weekday, err := parseWeekday(strings.TrimSpace(day))
+		if err != nil {
+			return nil, err
+		}
+		schedule.Days[weekday] = true
+	}
+
+	var err error
+	if schedule.Start, err = parseTimeOfDay(startTime); err != nil {
+		return nil, err
+	}
+	if schedule.End, err = parseTimeOfDay(endTime); err != nil {
+		return nil, err
+	}
+	if schedule.Location, err = time.LoadLocation(timeZone); err != nil {
+		return nil, fmt.Errorf("invalid time zone %s: %w", timeZone, err)
+	}
+	return schedule, nil
+}
+
+// parseWeekday parses a day by its name or a prefix of at least two letters of it, like kured
+func parseWeekday(day string) (time.Weekday, error) {
+	day = strings.ToLower(day)
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		name := strings.ToLower(weekday.String())
+		if len(day) >= 2 && strings.HasPrefix(name, day) {
+			return weekday, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid day: %q", day)
+}
+
+// parseTimeOfDay parses a time of day like "22:00" or "6:30:00" into the duration since midnight
+func parseTimeOfDay(value string) (time.Duration, error) {
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return clockTime(t), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid time of day: %q", value)
+}
+
+// clockTime returns the time of day shown by the clock as a duration, which differs from the time elapsed since
+// midnight on the days the clocks change
+func clockTime(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
+
+// Contains reports whether the time is inside the schedule, the day being the one of the time in the schedule time
+// zone, both ends included
+func (s *Schedule) Contains(t time.Time) bool {
+	t = t.In(s.Location)
+	if !s.Days[t.Weekday()] {
+		return false
+	}
+
+	timeOfDay := clockTime(t)
+	if s.End < s.Start {
+		return timeOfDay >= s.Start || timeOfDay <= s.End
+	}
+	return timeOfDay >= s.Start && timeOfDay <= s.End
+}
+
+// scheduleReports remembers the lock creation time of the reboots reported outside of the schedule, the schedule being
+// checked on both the lock and the Node events
+type scheduleReports struct {
+	mu       sync.Mutex
+	reported map[string]time.Time
+}
+
+func newScheduleReports() *scheduleReports {
+	return &scheduleReports{reported: map[string]time.Time{}}
+}
+
+// report reports whether the reboot of the node was not reported yet, remembering it
+func (r *scheduleReports) report(silenceNode kured.SilenceNode) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if lockCreated, ok := r.reported[silenceNode.NodeID]; ok && lockCreated.Equal(silenceNode.LockCreated) {
+		return false
+	}
+	r.reported[silenceNode.NodeID] = silenceNode.LockCreated
+	return true
+}
+
+// prune forgets the reboots of the nodes no longer holding the lock
+func (r *scheduleReports) prune(lock *kured.Lock) {
+	held := map[string]bool{}
+	for _, holder := range lock.Holders {
+		held[holder.NodeID] = true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for nodeID := range r.reported {
+		if !held[nodeID] {
+			delete(r.reported, nodeID)
+		}
+	}
+}
+
+// len returns the number of reboots remembered
+func (r *scheduleReports) len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.reported)
+}
+
+// scheduled returns the nodes whose reboot started inside the schedule, reporting the other ones once per lock
+func (c *Controller) scheduled(ctx context.Context, silenceNodes []kured.SilenceNode, obj runtime.Object) []kured.SilenceNode {
+	if c.config.Schedule == nil {
+		return silenceNodes
+	}
+
+	inSchedule := []kured.SilenceNode{}
+	for _, silenceNode := range silenceNodes {
+		if c.config.Schedule.Contains(silenceNode.LockCreated) {
+			inSchedule = append(inSchedule, silenceNode)
+			continue
+		}
+		if !c.outOfSchedule.report(silenceNode) {
+			continue
+		}
+		message := fmt.Sprintf("not silencing node %s: its reboot started at %s, outside of the maintenance schedule", silenceNode.NodeID, silenceNode.LockCreated.In(c.config.Schedule.Location).Format(time.RFC3339))
+		log.Warn(message)
+		c.metrics.refused(GuardReasonOutsideSchedule)
+		c.recordEvent(ctx, obj, GuardReasonOutsideSchedule, message)
+	}
+	return inSchedule
+}
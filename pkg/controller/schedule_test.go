@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		name      string
+		days      string
+		startTime string
+		endTime   string
+		timeZone  string
+		expectErr bool
+	}{
+		{name: "Defaults", days: DefaultScheduleDays, startTime: DefaultScheduleStartTime, endTime: DefaultScheduleEndTime, timeZone: "UTC"},
+		{name: "Full day names", days: "monday, Tuesday,wed", startTime: "22:00", endTime: "6:30:00", timeZone: "Europe/Berlin"},
+		{name: "Invalid day", days: "mo,xx", startTime: "22:00", endTime: "6:00", timeZone: "UTC", expectErr: true},
+		{name: "Ambiguous day", days: "t", startTime: "22:00", endTime: "6:00", timeZone: "UTC", expectErr: true},
+		{name: "Invalid time", days: "mo", startTime: "10pm", endTime: "6:00", timeZone: "UTC", expectErr: true},
+		{name: "Invalid time zone", days: "mo", startTime: "22:00", endTime: "6:00", timeZone: "Mars/Olympus", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSchedule(tt.days, tt.startTime, tt.endTime, tt.timeZone)
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestScheduleContains(t *testing.T) {
+	// weekdays from 22:00 to 06:00 in Berlin, where it is UTC+2 in summer
+	schedule, err := ParseSchedule("mo,tu,we,th,fr", "22:00", "6:00", "Europe/Berlin")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		time time.Time
+		want bool
+	}{
+		{"Friday evening", time.Date(2024, time.May, 31, 20, 30, 0, 0, time.UTC), true},
+		{"Friday morning", time.Date(2024, time.May, 31, 3, 59, 59, 0, time.UTC), true},
+		{"Friday afternoon", time.Date(2024, time.May, 31, 12, 0, 0, 0, time.UTC), false},
+		{"Friday morning after the end", time.Date(2024, time.May, 31, 4, 0, 1, 0, time.UTC), false},
+		{"Saturday night in Berlin", time.Date(2024, time.May, 31, 23, 0, 0, 0, time.UTC), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, schedule.Contains(tt.time))
+		})
+	}
+
+	// the clock time counts on the days the clocks change
+	schedule, err = ParseSchedule("su", "22:00", "23:59", "Europe/Berlin")
+	require.NoError(t, err)
+	assert.True(t, schedule.Contains(time.Date(2024, time.March, 31, 22, 30, 0, 0, schedule.Location)))
+	assert.False(t, schedule.Contains(time.Date(2024, time.October, 27, 21, 30, 0, 0, schedule.Location)))
+}
+
+func TestScheduled(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 12, 40, 0, 0, time.UTC)
+	controller, silencer := newTestController(func() time.Time {
+		return now
+	})
+	schedule, err := ParseSchedule(DefaultScheduleDays, "6:00", "12:00", "UTC")
+	require.NoError(t, err)
+	controller.config.Schedule = schedule
+	ctx := context.Background()
+
+	lockEvent := func(annotationValue string) {
+		controller.handleLockEvent(ctx, watch.Event{Type: watch.Modified, Object: &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "kured",
+				Namespace:   "kube-system",
+				Annotations: map[string]string{KuredNodeLockAnnotation: annotationValue},
+			},
+		}})
+	}
+
+	// the reboot of kind-worker2 started after the end of the schedule
+	annotationValue := `{"maxOwners":2,"locks":[` +
+		`{"nodeID":"kind-worker","created":"2024-05-31T11:50:00Z","TTL":0},` +
+		`{"nodeID":"kind-worker2","created":"2024-05-31T12:30:00Z","TTL":0}]}`
+	lockEvent(annotationValue)
+	lockEvent(annotationValue)
+	require.Len(t, silencer.Silences(), 1)
+	assert.Equal(t, "kind-worker", *silencer.Silences()[0].Matchers[0].Value)
+
+	// out of schedule reboots are reported once per lock
+	events, err := controller.client.CoreV1().Events("kube-system").List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, events.Items, 1)
+	assert.Equal(t, GuardReasonOutsideSchedule, events.Items[0].Reason)
+	assert.Equal(t, corev1.EventTypeWarning, events.Items[0].Type)
+	assert.Contains(t, events.Items[0].Message, "kind-worker2")
+
+	recorder := httptest.NewRecorder()
+	controller.MetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, recorder.Body.String(), `kured_alert_silencer_guard_refusals_total{reason="RebootOutsideSchedule"} 1`+"\n")
+
+	// the reboot is forgotten once the lock is released
+	require.Equal(t, 1, controller.outOfSchedule.len())
+	lockEvent(`{"maxOwners":2,"locks":[{"nodeID":"kind-worker","created":"2024-05-31T11:50:00Z","TTL":0}]}`)
+	assert.Equal(t, 0, controller.outOfSchedule.len())
+}
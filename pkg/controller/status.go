@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/trustyou/kured-alert-silencer/pkg/kured"
+	"github.com/trustyou/kured-alert-silencer/pkg/silence"
+)
+
+// TargetSilence is a silence of a target
+type TargetSilence struct {
+	Target string `json:"target"`
+	silence.Silence
+}
+
+// NodeStatus is the silence status of a node holding the kured lock
+type NodeStatus struct {
+	Node        string        `json:"node"`
+	LockCreated time.Time     `json:"lockCreated"`
+	LockAge     time.Duration `json:"lockAge"`
+	// WindowStart and WindowEnd are the expected silence window of the node
+	WindowStart time.Time `json:"windowStart"`
+	WindowEnd   time.Time `json:"windowEnd"`
+	// Silences are the active and pending silences of the node on every target
+	Silences []TargetSilence `json:"silences"`
+	// Gaps describe the alerts of the node that are not silenced as expected
+	Gaps []string `json:"gaps"`
+}
+
+// Status is the kured lock and the silences created by the silencer
+type Status struct {
+	Nodes []NodeStatus `json:"nodes"`
+	// Unmatched are the silences created by the silencer that match no node holding the lock, e.g. pending reboot,
+	// pod or orphaned silences
+	Unmatched []TargetSilence `json:"unmatched"`
+}
+
+// Status reads the kured lock and the silences created by the silencer on every target, and compares the silences
+// of each node holding the lock to the expected ones
+func (c *Controller) Status(ctx context.Context) (Status, error) {
+	obj, err := c.config.LockSource.Get(ctx)
+	if err != nil {
+		return Status{}, fmt.Errorf("failed to get %s: %w", c.config.LockSource, err)
+	}
+	lock, err := c.config.LockSource.Lock(obj)
+	if err != nil {
+		return Status{}, fmt.Errorf("failed to extract kured lock from %s: %w", c.config.LockSource, err)
+	}
+	lock = c.firstSeen.ResolveCreated(lock, c.config.NowProvider)
+
+	created := map[string][]TargetSilence{}
+	for _, target := range c.config.Targets {
+		tenants, err := c.targetTenants(ctx, target)
+		if err != nil {
+			return Status{}, fmt.Errorf("%s: %w", target.Name, err)
+		}
+		for _, tenant := range tenants {
+			silences, err := silence.ListCreatedSilences(silence.WithTenant(ctx, tenant), target.Silencer, c.config.Silence.CreatedBy)
+			if err != nil {
+				return Status{}, fmt.Errorf("%s: %w", target.Name, err)
+			}
+			for _, s := range silences {
+				created[s.Key()] = append(created[s.Key()], TargetSilence{Target: target.Name, Silence: s})
+			}
+		}
+	}
+
+	now := c.config.NowProvider()
+	status := Status{Nodes: []NodeStatus{}, Unmatched: []TargetSilence{}}
+	matched := map[string]bool{}
+	for _, silenceNode := range kured.ExtractLockNodes(lock, c.config.Window, c.config.NowProvider) {
+		nodeStatus, keys, err := c.nodeStatus(silenceNode, created, now)
+		if err != nil {
+			return Status{}, fmt.Errorf("node %s: %w", silenceNode.NodeID, err)
+		}
+		for _, key := range keys {
+			matched[key] = true
+		}
+		status.Nodes = append(status.Nodes, nodeStatus)
+	}
+	sort.Slice(status.Nodes, func(i, j int) bool {
+		return status.Nodes[i].Node < status.Nodes[j].Node
+	})
+
+	for key, silences := range created {
+		if !matched[key] {
+			status.Unmatched = append(status.Unmatched, silences...)
+		}
+	}
+	sortTargetSilences(status.Unmatched)
+	return status, nil
+}
+
+// nodeStatus compares the silences of a node holding the lock to the expected ones, returning the keys of the
+// expected silences
+func (c *Controller) nodeStatus(silenceNode kured.SilenceNode, created map[string][]TargetSilence, now time.Time) (NodeStatus, []string, error) {
+	nodeStatus := NodeStatus{
+		Node:        silenceNode.NodeID,
+		LockCreated: silenceNode.LockCreated,
+		LockAge:     now.Sub(silenceNode.LockCreated),
+		WindowStart: silenceNode.SilenceStart,
+		WindowEnd:   silenceNode.SilenceEnd,
+		Silences:    []TargetSilence{},
+		Gaps:        []string{},
+	}
+
+	// the silences expected on a target, the maintenance targets expecting a single window
+	targetExpected := map[string][]silence.Silence{}
+	for _, target := range c.config.Targets {
+		expected, err := silence.ExpectedSilences(target.silenceConfig(c.config.Silence), c.nodeTemplateData(silenceNode), silenceNode.SilenceStart, silenceNode.SilenceEnd)
+		if err != nil {
+			return NodeStatus{}, nil, err
+		}
+		targetExpected[target.Name] = expected
+	}
+	expected, err := silence.ExpectedSilences(c.config.Silence, c.nodeTemplateData(silenceNode), silenceNode.SilenceStart, silenceNode.SilenceEnd)
+	if err != nil {
+		return NodeStatus{}, nil, err
+	}
+	keys := []string{}
+	for _, e := range expected {
+		keys = append(keys, e.Key())
+		nodeStatus.Silences = append(nodeStatus.Silences, created[e.Key()]...)
+	}
+	sortTargetSilences(nodeStatus.Silences)
+
+	if c.config.Schedule != nil && !c.config.Schedule.Contains(silenceNode.LockCreated) {
+		nodeStatus.Gaps = append(nodeStatus.Gaps, "the reboot started outside of the maintenance schedule, its alerts are not silenced")
+		return nodeStatus, keys, nil
+	}
+	if !silenceNode.SilenceEnd.After(now) {
+		nodeStatus.Gaps = append(nodeStatus.Gaps, fmt.Sprintf("the lock is held for %s, its silence window ended at %s", nodeStatus.LockAge.Round(time.Second), silenceNode.SilenceEnd.Format(time.RFC3339)))
+		return nodeStatus, keys, nil
+	}
+
+	for _, target := range c.config.Targets {
+		for _, e := range targetExpected[target.Name] {
+			// the window of a matcher group may be over already
+			if !e.EndsAt.After(now) {
+				continue
+			}
+			// Alertmanager starts a silence created with a start in the past when it is created, so only a silence
+			// starting after both the expected start and now leaves alerts unsilenced
+			start := e.StartsAt
+			if start.Before(now) {
+				start = now
+			}
+			var latest *TargetSilence
+			for _, s := range created[e.Key()] {
+				if s.Target == target.Name && (latest == nil || s.EndsAt.After(latest.EndsAt)) {
+					latest = &s
+				}
+			}
+			switch {
+			case latest == nil:
+				nodeStatus.Gaps = append(nodeStatus.Gaps, fmt.Sprintf("%s: no silence %s", target.Name, e.MatchersString()))
+			case latest.EndsAt.Before(e.EndsAt):
+				nodeStatus.Gaps = append(nodeStatus.Gaps, fmt.Sprintf("%s: silence %s ends at %s, before %s", target.Name, e.MatchersString(), latest.EndsAt.Format(time.RFC3339), e.EndsAt.Format(time.RFC3339)))
+			case latest.StartsAt.After(start):
+				nodeStatus.Gaps = append(nodeStatus.Gaps, fmt.Sprintf("%s: silence %s starts at %s, after %s", target.Name, e.MatchersString(), latest.StartsAt.Format(time.RFC3339), start.Format(time.RFC3339)))
+			}
+		}
+	}
+	return nodeStatus, keys, nil
+}
+
+// sortTargetSilences sorts the silences by target and start
+func sortTargetSilences(silences []TargetSilence) {
+	sort.Slice(silences, func(i, j int) bool {
+		if silences[i].Target != silences[j].Target {
+			return silences[i].Target < silences[j].Target
+		}
+		return silences[i].StartsAt.Before(silences[j].StartsAt)
+	})
+}
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trustyou/kured-alert-silencer/pkg/silence"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestStatus(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 12, 40, 0, 0, time.UTC)
+	controller, silencer := newTestController(func() time.Time {
+		return now
+	})
+	ctx := context.Background()
+
+	for _, s := range []silence.Silence{
+		// kind-worker is silenced until before the end of its window
+		{Matchers: []*models.Matcher{newMatcher("instance", "kind-worker")}, StartsAt: now.Add(-10 * time.Minute), EndsAt: now.Add(20 * time.Minute)},
+		{Matchers: []*models.Matcher{newMatcher("instance", "kind-worker2")}, StartsAt: now.Add(-5 * time.Minute), EndsAt: now.Add(55 * time.Minute)},
+		{Matchers: []*models.Matcher{newMatcher("instance", "kind-worker5")}, StartsAt: now.Add(-5 * time.Minute), EndsAt: now.Add(time.Hour)},
+	} {
+		s.CreatedBy = silence.DefaultCreatedBy
+		_, err := silencer.CreateSilence(ctx, s)
+		require.NoError(t, err)
+	}
+	createSilences(t, silencer, now, "someone", []*models.Matcher{newMatcher("instance", "kind-worker4")})
+
+	// the lock of kind-worker3 is held past its window, kind-worker4 has no silence
+	_, err := controller.client.AppsV1().DaemonSets("kube-system").Create(ctx, &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "kured",
+			Namespace: "kube-system",
+			Annotations: map[string]string{KuredNodeLockAnnotation: `{"maxOwners":4,"locks":[` +
+				`{"nodeID":"kind-worker4","created":"2024-05-31T12:20:00Z","TTL":0},` +
+				`{"nodeID":"kind-worker","created":"2024-05-31T12:30:00Z","TTL":0},` +
+				`{"nodeID":"kind-worker2","created":"2024-05-31T12:35:00Z","TTL":0},` +
+				`{"nodeID":"kind-worker3","created":"2024-05-31T10:00:00Z","TTL":0}]}`},
+		},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	status, err := controller.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, status.Nodes, 4)
+
+	worker := status.Nodes[0]
+	assert.Equal(t, "kind-worker", worker.Node)
+	assert.Equal(t, 10*time.Minute, worker.LockAge)
+	assert.Equal(t, now.Add(50*time.Minute), worker.WindowEnd)
+	require.Len(t, worker.Silences, 1)
+	assert.Equal(t, "test", worker.Silences[0].Target)
+	assert.Equal(t, []string{`test: silence {instance="kind-worker"} ends at 2024-05-31T13:00:00Z, before 2024-05-31T13:30:00Z`}, worker.Gaps)
+
+	assert.Equal(t, "kind-worker2", status.Nodes[1].Node)
+	assert.Len(t, status.Nodes[1].Silences, 1)
+	assert.Empty(t, status.Nodes[1].Gaps)
+
+	assert.Equal(t, "kind-worker3", status.Nodes[2].Node)
+	assert.Empty(t, status.Nodes[2].Silences)
+	assert.Equal(t, []string{"the lock is held for 2h40m0s, its silence window ended at 2024-05-31T11:00:00Z"}, status.Nodes[2].Gaps)
+
+	assert.Equal(t, "kind-worker4", status.Nodes[3].Node)
+	assert.Empty(t, status.Nodes[3].Silences)
+	assert.Equal(t, []string{`test: no silence {instance="kind-worker4"}`}, status.Nodes[3].Gaps)
+
+	require.Len(t, status.Unmatched, 1)
+	assert.Equal(t, "kind-worker5", *status.Unmatched[0].Matchers[0].Value)
+	assert.Equal(t, models.SilenceStatusStateActive, status.Unmatched[0].State)
+}
+
+func TestStatusSilenceStart(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 12, 40, 0, 0, time.UTC)
+	controller, silencer := newTestController(func() time.Time {
+		return now
+	})
+	ctx := context.Background()
+
+	// the silences are created once the lock is seen, after it was created
+	daemonSet := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "kured",
+			Namespace: "kube-system",
+			Annotations: map[string]string{KuredNodeLockAnnotation: `{"maxOwners":2,"locks":[` +
+				`{"nodeID":"kind-worker","created":"2024-05-31T12:30:00Z","TTL":0},` +
+				`{"nodeID":"kind-worker2","created":"2024-05-31T12:35:00Z","TTL":0}]}`},
+		},
+	}
+	_, err := controller.client.AppsV1().DaemonSets("kube-system").Create(ctx, daemonSet, metav1.CreateOptions{})
+	require.NoError(t, err)
+	controller.handleLockEvent(ctx, watch.Event{Type: watch.Modified, Object: daemonSet})
+	require.Len(t, silencer.Silences(), 2)
+
+	// a pending silence starting later leaves the alerts of kind-worker2 unsilenced until then
+	require.NoError(t, silencer.ExpireSilence(ctx, silencer.Silences()[1].ID))
+	_, err = silencer.CreateSilence(ctx, silence.Silence{
+		Matchers:  []*models.Matcher{newMatcher("instance", "kind-worker2")},
+		StartsAt:  now.Add(5 * time.Minute),
+		EndsAt:    now.Add(time.Hour),
+		CreatedBy: silence.DefaultCreatedBy,
+	})
+	require.NoError(t, err)
+
+	status, err := controller.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, status.Nodes, 2)
+	assert.Empty(t, status.Nodes[0].Gaps)
+	assert.Equal(t, []string{`test: silence {instance="kind-worker2"} starts at 2024-05-31T12:45:00Z, after 2024-05-31T12:40:00Z`}, status.Nodes[1].Gaps)
+}
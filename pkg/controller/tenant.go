@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/trustyou/kured-alert-silencer/pkg/silence"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// errNoClient is returned when a tenant needs the node labels without access to the cluster, e.g. for the silence
+// command outside of it
+var errNoClient = errors.New("the tenant is templated from the node labels, which can't be read without access to the cluster")
+
+// errNodeLabels is returned when the labels of the node of a tenant can't be read, e.g. on a transient API error,
+// the silence is retried like on target errors
+var errNodeLabels = errors.New("failed to get the node labels")
+
+// usesNodeLabels reports whether the tenant template of the target needs the labels of the node, a template failing to
+// parse fails when rendered anyway
+func (t Target) usesNodeLabels() bool {
+	uses, err := silence.TenantUsesNodeLabels(t.Tenant)
+	return err != nil || uses
+}
+
+// tenantContext returns a context sending the tenant of the target rendered for the node of the template data
+func (c *Controller) tenantContext(ctx context.Context, target Target, data silence.TemplateData) (context.Context, error) {
+	if target.Tenant == "" {
+		return ctx, nil
+	}
+
+	if target.usesNodeLabels() && data.NodeLabels == nil {
+		if c.client == nil {
+			return nil, errNoClient
+		}
+		node, err := c.client.CoreV1().Nodes().Get(ctx, data.NodeName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("%w of node %s: %w", errNodeLabels, data.NodeName, err)
+		}
+		data.NodeLabels = node.Labels
+	}
+
+	tenant, err := silence.RenderTenant(target.Tenant, data)
+	if err != nil {
+		return nil, err
+	}
+	return silence.WithTenant(ctx, tenant), nil
+}
+
+// targetTenants returns the tenants of the target rendered for every node, a target without tenant has a single
+// empty tenant
+func (c *Controller) targetTenants(ctx context.Context, target Target) ([]string, error) {
+	if target.Tenant == "" {
+		return []string{""}, nil
+	}
+
+	data := []silence.TemplateData{c.config.TemplateData}
+	if target.usesNodeLabels() {
+		if c.client == nil {
+			return nil, errNoClient
+		}
+		nodes, err := c.client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		data = []silence.TemplateData{}
+		for _, node := range nodes.Items {
+			nodeData := c.config.TemplateData
+			nodeData.NodeName = node.Name
+			nodeData.NodeLabels = node.Labels
+			data = append(data, nodeData)
+		}
+	}
+
+	unique := map[string]bool{}
+	for _, nodeData := range data {
+		tenant, err := silence.RenderTenant(target.Tenant, nodeData)
+		if err != nil {
+			return nil, err
+		}
+		unique[tenant] = true
+	}
+
+	tenants := []string{}
+	for tenant := range unique {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	return tenants, nil
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trustyou/kured-alert-silencer/pkg/kured"
+	"github.com/trustyou/kured-alert-silencer/pkg/silence"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// tenantSilencer records the tenant of each created silence
+type tenantSilencer struct {
+	*silence.FakeSilencer
+
+	mu      sync.Mutex
+	tenants []string
+}
+
+func (s *tenantSilencer) CreateSilence(ctx context.Context, sil silence.Silence) (string, error) {
+	s.mu.Lock()
+	s.tenants = append(s.tenants, silence.TenantFromContext(ctx))
+	s.mu.Unlock()
+	return s.FakeSilencer.CreateSilence(ctx, sil)
+}
+
+func TestSilenceTenant(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	controller, _ := newTestController(func() time.Time {
+		return now
+	})
+	silencer := &tenantSilencer{FakeSilencer: silence.NewFakeSilencer(controller.config.NowProvider)}
+	controller.config.Targets = []Target{{Name: "mimir", Silencer: silencer, Tenant: `{{index .NodeLabels "example.com/tenant"}}`}}
+
+	ctx := context.Background()
+	for name, tenant := range map[string]string{"kind-worker": "team-a", "kind-worker2": "team-b", "kind-worker3": "team-a"} {
+		_, err := controller.client.CoreV1().Nodes().Create(ctx, &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"example.com/tenant": tenant}},
+		}, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+
+	for _, nodeName := range []string{"kind-worker", "kind-worker2"} {
+		silenceNode := kured.SilenceNode{NodeID: nodeName, SilenceStart: now, SilenceEnd: now.Add(time.Hour)}
+		err := controller.silence(ctx, controller.config.Targets, controller.config.Silence, controller.nodeTemplateData(silenceNode), silenceNode.SilenceStart, silenceNode.SilenceEnd)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"team-a", "team-b"}, silencer.tenants)
+
+	tenants, err := controller.targetTenants(ctx, controller.config.Targets[0])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"team-a", "team-b"}, tenants)
+
+	// the silence fails when the labels of its node can't be fetched, and is retried
+	controller.retryQueue.jitter = func(max time.Duration) time.Duration {
+		return 0
+	}
+	silenceNode := kured.SilenceNode{NodeID: "kind-worker4", SilenceStart: now, SilenceEnd: now.Add(time.Hour)}
+	err = controller.silence(ctx, controller.config.Targets, controller.config.Silence, controller.nodeTemplateData(silenceNode), silenceNode.SilenceStart, silenceNode.SilenceEnd)
+	require.ErrorIs(t, err, errNodeLabels)
+	assert.Len(t, silencer.Silences(), 2)
+	require.Equal(t, 1, controller.retryQueue.len())
+
+	_, err = controller.client.CoreV1().Nodes().Create(ctx, &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "kind-worker4", Labels: map[string]string{"example.com/tenant": "team-c"}},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	now = now.Add(time.Second)
+	controller.retry(ctx)
+	assert.Len(t, silencer.Silences(), 3)
+	assert.Equal(t, []string{"team-a", "team-b", "team-c"}, silencer.tenants)
+	assert.Equal(t, 0, controller.retryQueue.len())
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+)
+
+const (
+	// DefaultMinSilenceDuration is the shortest silence duration accepted when no minimum is configured
+	DefaultMinSilenceDuration = time.Minute
+	// DefaultMaxSilenceDuration is the longest silence duration accepted when no maximum is configured
+	DefaultMaxSilenceDuration = 24 * time.Hour
+)
+
+// validateDuration checks that the duration is within the bounds
+func validateDuration(name string, duration time.Duration, minDuration time.Duration, maxDuration time.Duration) error {
+	if duration < minDuration || duration > maxDuration {
+		return fmt.Errorf("%s %s is not between %s and %s", name, duration, minDuration, maxDuration)
+	}
+	return nil
+}
+
+// ValidateTargetExclusions refuses exclusion matchers along with maintenance targets, which mute every alert of their
+// services whatever the exclusions, e.g. the critical alerts still expected to page
+func ValidateTargetExclusions(targets []Target, exclusions []*models.Matcher) error {
+	if len(exclusions) == 0 {
+		return nil
+	}
+	for _, target := range targets {
+		if target.Maintenance {
+			return fmt.Errorf("target %s creates maintenance windows which can't exclude alerts, drop the node silence exclusion matchers or the target", target.Name)
+		}
+	}
+	return nil
+}
+
+// Validate checks the silence durations against the bounds and the templates of every enabled silence, returning
+// every problem found
+func (c Config) Validate(minDuration time.Duration, maxDuration time.Duration) error {
+	errs := []error{}
+	if minDuration > maxDuration {
+		errs = append(errs, fmt.Errorf("minimum silence duration %s is above the maximum %s", minDuration, maxDuration))
+	}
+
+	if err := validateDuration("silence duration", c.Window.Duration, minDuration, maxDuration); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Window.Lag < 0 {
+		errs = append(errs, fmt.Errorf("silence lag time %s is negative", c.Window.Lag))
+	}
+	if window := c.Window.Duration + c.Window.Lag; window > maxDuration {
+		errs = append(errs, fmt.Errorf("silence duration and lag time add up to %s, above the maximum %s", window, maxDuration))
+	}
+	if err := c.Silence.Validate(c.TemplateData, minDuration, maxDuration); err != nil {
+		errs = append(errs, fmt.Errorf("silence %w", err))
+	}
+
+	if c.PreReboot.NodeKey != "" || c.PreReboot.MetricsURL != "" {
+		if err := validateDuration("pre-reboot silence duration", c.PreReboot.Duration, minDuration, maxDuration); err != nil {
+			errs = append(errs, err)
+		}
+		if err := c.PreReboot.Silence.Validate(c.TemplateData, minDuration, maxDuration); err != nil {
+			errs = append(errs, fmt.Errorf("pre-reboot silence %w", err))
+		}
+	}
+
+	switch c.Pods.Mode {
+	case "":
+	case PodSilenceModePod, PodSilenceModeWorkload:
+		if err := c.podSilenceConfig().Validate(c.TemplateData, minDuration, maxDuration); err != nil {
+			errs = append(errs, fmt.Errorf("pod silence %w", err))
+		}
+		// the cleanup tells the silences of the pods evicted from a rebooting node by their comment
+		if referenced, err := c.Silence.CommentReferencesNode(c.TemplateData); err == nil && !referenced {
+			errs = append(errs, fmt.Errorf("pod silence comment: the silence comment template must render {{.NodeName}}"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown pod silence mode: %s", c.Pods.Mode))
+	}
+
+	if len(c.Targets) == 0 {
+		errs = append(errs, fmt.Errorf("no silence target"))
+	}
+	if err := ValidateTargetExclusions(c.Targets, c.Silence.Exclusions); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
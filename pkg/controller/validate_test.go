@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trustyou/kured-alert-silencer/pkg/silence"
+)
+
+func TestConfigValidate(t *testing.T) {
+	controller, _ := newTestController(time.Now)
+	require.NoError(t, controller.config.Validate(DefaultMinSilenceDuration, DefaultMaxSilenceDuration))
+
+	config := controller.config
+	config.Window.Duration = 48 * time.Hour
+	config.Window.Lag = -time.Minute
+	config.PreReboot.Duration = time.Second
+	config.Silence.MatchersJSON = `[{"name": "instance", "value": ".*", "isRegex": true}]`
+	config.Pods.Mode = "container"
+	err := config.Validate(DefaultMinSilenceDuration, DefaultMaxSilenceDuration)
+	require.Error(t, err)
+
+	// every problem is reported
+	assert.Contains(t, err.Error(), "silence duration 48h0m0s is not between 1m0s and 24h0m0s")
+	assert.Contains(t, err.Error(), "silence lag time -1m0s is negative")
+	assert.Contains(t, err.Error(), "pre-reboot silence duration 1s is not between 1m0s and 24h0m0s")
+	assert.Contains(t, err.Error(), `matcher instance=~".*" matches any value`)
+	assert.Contains(t, err.Error(), "unknown pod silence mode: container")
+
+	// the lag time counts towards the maximum
+	config = controller.config
+	config.Window.Lag = 24 * time.Hour
+	assert.Error(t, config.Validate(DefaultMinSilenceDuration, DefaultMaxSilenceDuration))
+
+	// the comment of the pod silences tells their node
+	config = controller.config
+	config.Pods = PodSilenceConfig{Mode: PodSilenceModePod, MatchersJSON: DefaultPodMatchersJSON}
+	require.NoError(t, config.Validate(DefaultMinSilenceDuration, DefaultMaxSilenceDuration))
+	config.Silence.CommentTemplate = "node reboot in {{.ClusterName}}"
+	assert.ErrorContains(t, config.Validate(DefaultMinSilenceDuration, DefaultMaxSilenceDuration), "must render {{.NodeName}}")
+
+	// maintenance windows can't exclude alerts
+	config = controller.config
+	exclusions, err := silence.ParseExclusions(`{severity!="critical"}`)
+	require.NoError(t, err)
+	config.Silence.Exclusions = exclusions
+	require.NoError(t, config.Validate(DefaultMinSilenceDuration, DefaultMaxSilenceDuration))
+	config.Targets = append(config.Targets, Target{Name: "pagerduty", Silencer: silence.NewFakeSilencer(time.Now), Maintenance: true})
+	assert.ErrorContains(t, config.Validate(DefaultMinSilenceDuration, DefaultMaxSilenceDuration), "target pagerduty creates maintenance windows")
+}
@@ -1,79 +1,198 @@
 package kured
 
 import (
-	"encoding/json"
+	"sort"
+	"sync"
 	"time"
 
 	v1 "k8s.io/api/apps/v1"
 )
 
-// this can be extracted from "github.com/kubereboot/kured/pkg/daemonsetlock"
-type lockAnnotationValue struct {
-	NodeID   string        `json:"nodeID"`
-	Metadata interface{}   `json:"metadata,omitempty"`
-	Created  time.Time     `json:"created"`
-	TTL      time.Duration `json:"TTL"`
+type SilenceNode struct {
+	NodeID       string
+	LockCreated  time.Time
+	LockMetadata map[string]interface{}
+	SilenceStart time.Time
+	SilenceEnd   time.Time
 }
 
-// this can be extracted from "github.com/kubereboot/kured/pkg/daemonsetlock"
-type multiLockAnnotationValue struct {
-	MaxOwners       int                   `json:"maxOwners"`
-	LockAnnotations []lockAnnotationValue `json:"locks"`
+// Unschedulable reports whether kured recorded the node as already unschedulable when taking the lock
+func (n SilenceNode) Unschedulable() bool {
+	unschedulable, ok := n.LockMetadata["unschedulable"].(bool)
+	return ok && unschedulable
 }
 
-type SilenceNode struct {
-	NodeID     string
-	SilenceEnd time.Time
+type TimeProvider func() time.Time
+
+// SilenceWindow configures how the silence start and end are derived from a kured lock
+type SilenceWindow struct {
+	// Duration is the silence length measured from the lock creation, a shorter lock TTL takes precedence
+	Duration time.Duration
+	// Lag keeps the silence active after the lock is released
+	Lag time.Duration
 }
 
-type TimeProvider func() time.Time
+// silenceNode derives the silence window of a held lock, locks without creation time are considered created at the
+// time they are observed, see FirstSeenTracker to keep that time across events
+func (w SilenceWindow) silenceNode(holder LockHolder, now time.Time) SilenceNode {
+	created := holder.Created
+	if created.IsZero() {
+		created = now
+	}
 
-func ExtractNodeIDsFromAnnotation(ds *v1.DaemonSet, annotation string, silenceDuration time.Duration, nowProvider TimeProvider) ([]SilenceNode, error) {
-	now := nowProvider()
-	silencerArray := []SilenceNode{}
+	duration := w.Duration
+	// kured releases the lock by itself once the TTL is over
+	if holder.TTL > 0 && holder.TTL < duration {
+		duration = holder.TTL
+	}
 
+	return SilenceNode{
+		NodeID:       holder.NodeID,
+		LockCreated:  created,
+		LockMetadata: holder.Metadata,
+		SilenceStart: created,
+		SilenceEnd:   created.Add(duration),
+	}
+}
+
+func ExtractNodeIDsFromAnnotation(ds *v1.DaemonSet, annotation string, window SilenceWindow, nowProvider TimeProvider) ([]SilenceNode, error) {
 	if _, ok := ds.Annotations[annotation]; !ok {
-		return silencerArray, nil
+		return []SilenceNode{}, nil
 	}
 
-	multiLock := &multiLockAnnotationValue{}
-	err := json.Unmarshal([]byte(ds.Annotations[annotation]), multiLock)
+	lock, err := ParseLockAnnotation(ds.Annotations[annotation])
 	if err != nil {
 		return nil, err
 	}
 
-	for _, lock := range multiLock.LockAnnotations {
-		// TODO: silence just for silenceEnd.Sub(now) duration
-		silenceEnd := lock.Created.Add(silenceDuration)
-		if silenceEnd.After(now) {
-			silencerArray = append(silencerArray, SilenceNode{
-				NodeID:     lock.NodeID,
-				SilenceEnd: silenceEnd,
-			})
+	return ExtractSilenceNodes(lock, window, nowProvider), nil
+}
+
+// ExtractSilenceNodes returns the nodes holding the lock whose silence window is not over yet
+func ExtractSilenceNodes(lock *Lock, window SilenceWindow, nowProvider TimeProvider) []SilenceNode {
+	now := nowProvider()
+	silencerArray := []SilenceNode{}
+
+	for _, silenceNode := range ExtractLockNodes(lock, window, nowProvider) {
+		if silenceNode.SilenceEnd.After(now) {
+			silencerArray = append(silencerArray, silenceNode)
 		}
 	}
 
-	if len(silencerArray) > 0 {
-		return silencerArray, nil
+	return silencerArray
+}
+
+// ExtractLockNodes returns every node holding the lock with its silence window, including the windows already over
+func ExtractLockNodes(lock *Lock, window SilenceWindow, nowProvider TimeProvider) []SilenceNode {
+	now := nowProvider()
+	silencerArray := []SilenceNode{}
+
+	for _, holder := range lock.Holders {
+		silencerArray = append(silencerArray, window.silenceNode(holder, now))
 	}
 
-	singleLock := &lockAnnotationValue{}
-	err = json.Unmarshal([]byte(ds.Annotations[annotation]), singleLock)
-	if err != nil {
-		return nil, err
+	return silencerArray
+}
+
+// FirstSeenTracker remembers when each holder of a lock without creation time was first seen, e.g. legacy locks and
+// Leases without acquire time, so that their silence window does not move forward with every event
+type FirstSeenTracker struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func NewFirstSeenTracker() *FirstSeenTracker {
+	return &FirstSeenTracker{seen: map[string]time.Time{}}
+}
+
+// ResolveCreated returns a copy of the lock whose holders without creation time are created when first seen,
+// forgetting the nodes no longer holding the lock
+func (t *FirstSeenTracker) ResolveCreated(lock *Lock, nowProvider TimeProvider) *Lock {
+	now := nowProvider()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	resolved := *lock
+	resolved.Holders = []LockHolder{}
+	seen := map[string]time.Time{}
+	for _, holder := range lock.Holders {
+		if holder.Created.IsZero() {
+			firstSeen, ok := t.seen[holder.NodeID]
+			if !ok {
+				firstSeen = now
+			}
+			seen[holder.NodeID] = firstSeen
+			holder.Created = firstSeen
+		}
+		resolved.Holders = append(resolved.Holders, holder)
 	}
+	t.seen = seen
+	return &resolved
+}
+
+// ReleaseTracker remembers the lock holders seen on the lock source to detect released locks
+type ReleaseTracker struct {
+	mu   sync.Mutex
+	held map[string]LockHolder
+	// lagging holds the end of the lag window of the released nodes
+	lagging map[string]time.Time
+}
 
-	if singleLock.NodeID != "manual" {
-		// TODO: silence just for silenceEnd.Sub(now) duration
-		silenceEnd := singleLock.Created.Add(silenceDuration)
-		if silenceEnd.After(now) {
-			silencerArray = append(silencerArray, SilenceNode{
-				NodeID:     singleLock.NodeID,
-				SilenceEnd: silenceEnd,
-			})
+func NewReleaseTracker() *ReleaseTracker {
+	return &ReleaseTracker{held: map[string]LockHolder{}, lagging: map[string]time.Time{}}
+}
+
+// ExtractReleasedNodes returns the nodes whose lock was released since the previous call,
+// silenced until the window lag after now. Nothing is returned when the window has no lag.
+func (r *ReleaseTracker) ExtractReleasedNodes(lock *Lock, window SilenceWindow, nowProvider TimeProvider) []SilenceNode {
+	now := nowProvider()
+	silencerArray := []SilenceNode{}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	held := map[string]LockHolder{}
+	for _, holder := range lock.Holders {
+		held[holder.NodeID] = holder
+		delete(r.lagging, holder.NodeID)
+	}
+
+	for nodeID, holder := range r.held {
+		if _, ok := held[nodeID]; ok || window.Lag <= 0 {
+			continue
+		}
+		silenceNode := window.silenceNode(holder, now)
+		silenceNode.SilenceEnd = now.Add(window.Lag)
+		silencerArray = append(silencerArray, silenceNode)
+		r.lagging[nodeID] = silenceNode.SilenceEnd
+	}
+	r.held = held
+
+	sort.Slice(silencerArray, func(i, j int) bool {
+		return silencerArray[i].NodeID < silencerArray[j].NodeID
+	})
+	return silencerArray
+}
+
+// SilencedNodes returns the sorted nodes holding the lock and the released nodes still in their lag window
+func (r *ReleaseTracker) SilencedNodes(nowProvider TimeProvider) []string {
+	now := nowProvider()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	nodeNames := []string{}
+	for nodeID := range r.held {
+		nodeNames = append(nodeNames, nodeID)
+	}
+	for nodeID, end := range r.lagging {
+		if !end.After(now) {
+			delete(r.lagging, nodeID)
+			continue
 		}
-		return silencerArray, nil
-	} else {
-		return silencerArray, nil
+		nodeNames = append(nodeNames, nodeID)
 	}
+	sort.Strings(nodeNames)
+	return nodeNames
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/trustyou/kured-alert-silencer/pkg/kured"
 
 	v1 "k8s.io/api/apps/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -34,7 +35,11 @@ func TestExtractNodeIDsFromAnnotation(t *testing.T) {
 			annotationValue: `{"nodeID":"kind-control-plane2","metadata":{"unschedulable":false},"created":"2024-05-31T06:31:37.441623522Z","TTL":0}`,
 			want: []kured.SilenceNode{
 				{
-					"kind-control-plane2", time.Date(2024, time.May, 31, 7, 31, 37, 441623522, time.UTC),
+					NodeID:       "kind-control-plane2",
+					LockCreated:  time.Date(2024, time.May, 31, 6, 31, 37, 441623522, time.UTC),
+					LockMetadata: map[string]interface{}{"unschedulable": false},
+					SilenceStart: time.Date(2024, time.May, 31, 6, 31, 37, 441623522, time.UTC),
+					SilenceEnd:   time.Date(2024, time.May, 31, 7, 31, 37, 441623522, time.UTC),
 				},
 			},
 		},
@@ -48,10 +53,18 @@ func TestExtractNodeIDsFromAnnotation(t *testing.T) {
 			annotationValue: `{"maxOwners":2,"locks":[{"nodeID":"kind-worker2","metadata":{"unschedulable":false},"created":"2024-05-31T06:31:32.735905893Z","TTL":0},{"nodeID":"kind-control-plane","metadata":{"unschedulable":false},"created":"2024-05-31T06:31:49.868231413Z","TTL":0}]}`,
 			want: []kured.SilenceNode{
 				{
-					"kind-worker2", time.Date(2024, time.May, 31, 7, 31, 32, 735905893, time.UTC),
+					NodeID:       "kind-worker2",
+					LockCreated:  time.Date(2024, time.May, 31, 6, 31, 32, 735905893, time.UTC),
+					LockMetadata: map[string]interface{}{"unschedulable": false},
+					SilenceStart: time.Date(2024, time.May, 31, 6, 31, 32, 735905893, time.UTC),
+					SilenceEnd:   time.Date(2024, time.May, 31, 7, 31, 32, 735905893, time.UTC),
 				},
 				{
-					"kind-control-plane", time.Date(2024, time.May, 31, 7, 31, 49, 868231413, time.UTC),
+					NodeID:       "kind-control-plane",
+					LockCreated:  time.Date(2024, time.May, 31, 6, 31, 49, 868231413, time.UTC),
+					LockMetadata: map[string]interface{}{"unschedulable": false},
+					SilenceStart: time.Date(2024, time.May, 31, 6, 31, 49, 868231413, time.UTC),
+					SilenceEnd:   time.Date(2024, time.May, 31, 7, 31, 49, 868231413, time.UTC),
 				},
 			},
 		},
@@ -60,15 +73,63 @@ func TestExtractNodeIDsFromAnnotation(t *testing.T) {
 			annotationValue: `{"maxOwners":2,"locks":[{"nodeID":"kind-worker2","metadata":{"unschedulable":false},"created":"2024-05-30T00:00:32.735905893Z","TTL":0},{"nodeID":"kind-control-plane","metadata":{"unschedulable":false},"created":"2024-05-31T06:31:49.868231413Z","TTL":0}]}`,
 			want: []kured.SilenceNode{
 				{
-					"kind-control-plane", time.Date(2024, time.May, 31, 7, 31, 49, 868231413, time.UTC),
+					NodeID:       "kind-control-plane",
+					LockCreated:  time.Date(2024, time.May, 31, 6, 31, 49, 868231413, time.UTC),
+					LockMetadata: map[string]interface{}{"unschedulable": false},
+					SilenceStart: time.Date(2024, time.May, 31, 6, 31, 49, 868231413, time.UTC),
+					SilenceEnd:   time.Date(2024, time.May, 31, 7, 31, 49, 868231413, time.UTC),
 				},
 			},
 		},
+		{
+			name:            "lock TTL shorter than silence duration",
+			annotationValue: `{"nodeID":"kind-worker","metadata":{"unschedulable":true},"created":"2024-05-31T06:31:00Z","TTL":1800000000000}`,
+			want: []kured.SilenceNode{
+				{
+					NodeID:       "kind-worker",
+					LockCreated:  time.Date(2024, time.May, 31, 6, 31, 0, 0, time.UTC),
+					LockMetadata: map[string]interface{}{"unschedulable": true},
+					SilenceStart: time.Date(2024, time.May, 31, 6, 31, 0, 0, time.UTC),
+					SilenceEnd:   time.Date(2024, time.May, 31, 7, 1, 0, 0, time.UTC),
+				},
+			},
+		},
+		{
+			name:            "lock TTL longer than silence duration",
+			annotationValue: `{"nodeID":"kind-worker","metadata":{"unschedulable":false},"created":"2024-05-31T06:31:00Z","TTL":7200000000000}`,
+			want: []kured.SilenceNode{
+				{
+					NodeID:       "kind-worker",
+					LockCreated:  time.Date(2024, time.May, 31, 6, 31, 0, 0, time.UTC),
+					LockMetadata: map[string]interface{}{"unschedulable": false},
+					SilenceStart: time.Date(2024, time.May, 31, 6, 31, 0, 0, time.UTC),
+					SilenceEnd:   time.Date(2024, time.May, 31, 7, 31, 0, 0, time.UTC),
+				},
+			},
+		},
+		{
+			name:            "lock TTL already expired",
+			annotationValue: `{"nodeID":"kind-worker","metadata":{"unschedulable":false},"created":"2024-05-31T06:31:00Z","TTL":60000000000}`,
+			want:            []kured.SilenceNode{},
+		},
 		{
 			name:            "manual lock",
 			annotationValue: `{"nodeID":"manual"}`,
 			want:            []kured.SilenceNode{},
 		},
+		{
+			name:            "legacy lock without creation time",
+			annotationValue: `{"nodeID":"kind-worker","metadata":{"unschedulable":false}}`,
+			want: []kured.SilenceNode{
+				{
+					NodeID:       "kind-worker",
+					LockCreated:  fixedTime,
+					LockMetadata: map[string]interface{}{"unschedulable": false},
+					SilenceStart: fixedTime,
+					SilenceEnd:   fixedTime.Add(time.Hour),
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -81,7 +142,7 @@ func TestExtractNodeIDsFromAnnotation(t *testing.T) {
 				},
 			}
 
-			result, err := kured.ExtractNodeIDsFromAnnotation(ds, KuredNodeLockAnnotation, silenceDuration, timeProvider)
+			result, err := kured.ExtractNodeIDsFromAnnotation(ds, KuredNodeLockAnnotation, kured.SilenceWindow{Duration: silenceDuration}, timeProvider)
 			require.NoError(t, err)
 			require.Equal(t, tt.want, result)
 
@@ -105,8 +166,316 @@ func TestExtractNodeIDsFromAnnotationNoAnnotation(t *testing.T) {
 		assert.NoError(t, err)
 	}
 
-	result, err := kured.ExtractNodeIDsFromAnnotation(ds, "weave.works/kured-node-lock", silenceDuration, timeProvider)
+	result, err := kured.ExtractNodeIDsFromAnnotation(ds, "weave.works/kured-node-lock", kured.SilenceWindow{Duration: silenceDuration}, timeProvider)
 	require.NoError(t, err)
 	require.Equal(t, []kured.SilenceNode{}, result)
 
 }
+
+func TestSilenceNodeUnschedulable(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata map[string]interface{}
+		want     bool
+	}{
+		{"no metadata", nil, false},
+		{"schedulable", map[string]interface{}{"unschedulable": false}, false},
+		{"unschedulable", map[string]interface{}{"unschedulable": true}, true},
+		{"unexpected type", map[string]interface{}{"unschedulable": "true"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, kured.SilenceNode{LockMetadata: tt.metadata}.Unschedulable())
+		})
+	}
+}
+
+func TestReleaseTracker(t *testing.T) {
+	fixedTime := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	timeProvider := func() time.Time {
+		return fixedTime
+	}
+	lockCreated := time.Date(2024, time.May, 31, 6, 31, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		window  kured.SilenceWindow
+		updates []string
+		want    []kured.SilenceNode
+	}{
+		{
+			name:   "lock still held",
+			window: kured.SilenceWindow{Duration: time.Hour, Lag: 10 * time.Minute},
+			updates: []string{
+				`{"nodeID":"kind-worker","created":"2024-05-31T06:31:00Z","TTL":0}`,
+				`{"nodeID":"kind-worker","created":"2024-05-31T06:31:00Z","TTL":0}`,
+			},
+			want: []kured.SilenceNode{},
+		},
+		{
+			name:   "single lock released",
+			window: kured.SilenceWindow{Duration: time.Hour, Lag: 10 * time.Minute},
+			updates: []string{
+				`{"nodeID":"kind-worker","created":"2024-05-31T06:31:00Z","TTL":0}`,
+				"",
+			},
+			want: []kured.SilenceNode{
+				{
+					NodeID:       "kind-worker",
+					LockCreated:  lockCreated,
+					SilenceStart: lockCreated,
+					SilenceEnd:   fixedTime.Add(10 * time.Minute),
+				},
+			},
+		},
+		{
+			name:   "one of multiple locks released",
+			window: kured.SilenceWindow{Duration: time.Hour, Lag: 10 * time.Minute},
+			updates: []string{
+				`{"maxOwners":2,"locks":[{"nodeID":"kind-worker","created":"2024-05-31T06:31:00Z","TTL":0},{"nodeID":"kind-worker2","created":"2024-05-31T06:32:00Z","TTL":0}]}`,
+				`{"maxOwners":2,"locks":[{"nodeID":"kind-worker2","created":"2024-05-31T06:32:00Z","TTL":0}]}`,
+			},
+			want: []kured.SilenceNode{
+				{
+					NodeID:       "kind-worker",
+					LockCreated:  lockCreated,
+					SilenceStart: lockCreated,
+					SilenceEnd:   fixedTime.Add(10 * time.Minute),
+				},
+			},
+		},
+		{
+			name:   "lock released without lag",
+			window: kured.SilenceWindow{Duration: time.Hour},
+			updates: []string{
+				`{"nodeID":"kind-worker","created":"2024-05-31T06:31:00Z","TTL":0}`,
+				"",
+			},
+			want: []kured.SilenceNode{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := kured.NewReleaseTracker()
+
+			var result []kured.SilenceNode
+			for _, update := range tt.updates {
+				lock := &kured.Lock{}
+				if update != "" {
+					var err error
+					lock, err = kured.ParseLockAnnotation(update)
+					require.NoError(t, err)
+				}
+				result = tracker.ExtractReleasedNodes(lock, tt.window, timeProvider)
+			}
+			require.Equal(t, tt.want, result)
+		})
+	}
+}
+
+func TestReleaseTrackerSilencedNodes(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	timeProvider := func() time.Time {
+		return now
+	}
+	window := kured.SilenceWindow{Duration: time.Hour, Lag: 10 * time.Minute}
+	tracker := kured.NewReleaseTracker()
+
+	lock, err := kured.ParseLockAnnotation(`{"maxOwners":2,"locks":[` +
+		`{"nodeID":"kind-worker","created":"2024-05-31T06:31:00Z","TTL":0},` +
+		`{"nodeID":"kind-worker2","created":"2024-05-31T06:31:00Z","TTL":0}]}`)
+	require.NoError(t, err)
+	tracker.ExtractReleasedNodes(lock, window, timeProvider)
+	assert.Equal(t, []string{"kind-worker", "kind-worker2"}, tracker.SilencedNodes(timeProvider))
+
+	// kind-worker is in its lag window after releasing the lock
+	lock, err = kured.ParseLockAnnotation(`{"maxOwners":2,"locks":[{"nodeID":"kind-worker2","created":"2024-05-31T06:31:00Z","TTL":0}]}`)
+	require.NoError(t, err)
+	tracker.ExtractReleasedNodes(lock, window, timeProvider)
+	assert.Equal(t, []string{"kind-worker", "kind-worker2"}, tracker.SilencedNodes(timeProvider))
+
+	now = now.Add(10 * time.Minute)
+	assert.Equal(t, []string{"kind-worker2"}, tracker.SilencedNodes(timeProvider))
+}
+
+func TestFirstSeenTracker(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	timeProvider := func() time.Time {
+		return now
+	}
+	lockCreated := time.Date(2024, time.May, 31, 6, 31, 0, 0, time.UTC)
+	window := kured.SilenceWindow{Duration: time.Hour}
+	tracker := kured.NewFirstSeenTracker()
+
+	legacy, err := kured.ParseLockAnnotation(`{"nodeID":"kind-worker"}`)
+	require.NoError(t, err)
+	lock := tracker.ResolveCreated(legacy, timeProvider)
+	require.Equal(t, []kured.SilenceNode{{NodeID: "kind-worker", LockCreated: now, SilenceStart: now, SilenceEnd: now.Add(time.Hour)}}, kured.ExtractSilenceNodes(lock, window, timeProvider))
+	require.True(t, legacy.Holders[0].Created.IsZero())
+
+	// the window of the legacy lock does not move with the following events
+	firstSeen := now
+	now = now.Add(10 * time.Minute)
+	lock = tracker.ResolveCreated(legacy, timeProvider)
+	require.Equal(t, firstSeen, lock.Holders[0].Created)
+
+	// locks with creation time are kept as is
+	single, err := kured.ParseLockAnnotation(`{"nodeID":"kind-worker2","created":"2024-05-31T06:31:00Z","TTL":0}`)
+	require.NoError(t, err)
+	lock = tracker.ResolveCreated(single, timeProvider)
+	require.Equal(t, lockCreated, lock.Holders[0].Created)
+
+	// a released lock is forgotten, taking it again starts a new window
+	lock = tracker.ResolveCreated(legacy, timeProvider)
+	require.Equal(t, now, lock.Holders[0].Created)
+}
+
+func TestParseLockAnnotation(t *testing.T) {
+	tests := []struct {
+		name            string
+		annotationValue string
+		want            *kured.Lock
+		expectErr       bool
+	}{
+		{
+			name:            "kured 1.6 legacy lock",
+			annotationValue: `{"nodeID":"ip-10-0-1-23.ec2.internal","metadata":{"unschedulable":false}}`,
+			want: &kured.Lock{
+				Format:    kured.LockFormatLegacy,
+				MaxOwners: 1,
+				Holders: []kured.LockHolder{
+					{NodeID: "ip-10-0-1-23.ec2.internal", Metadata: map[string]interface{}{"unschedulable": false}},
+				},
+			},
+		},
+		{
+			name:            "kured 1.15 single lock",
+			annotationValue: `{"nodeID":"kind-control-plane2","metadata":{"unschedulable":false},"created":"2024-05-31T06:31:37.441623522Z","TTL":0}`,
+			want: &kured.Lock{
+				Format:    kured.LockFormatSingle,
+				MaxOwners: 1,
+				Holders: []kured.LockHolder{
+					{
+						NodeID:   "kind-control-plane2",
+						Metadata: map[string]interface{}{"unschedulable": false},
+						Created:  time.Date(2024, time.May, 31, 6, 31, 37, 441623522, time.UTC),
+					},
+				},
+			},
+		},
+		{
+			name:            "kured 1.15 single lock with lock TTL",
+			annotationValue: `{"nodeID":"kind-worker","metadata":{"unschedulable":true},"created":"2024-05-31T06:31:00Z","TTL":1800000000000}`,
+			want: &kured.Lock{
+				Format:    kured.LockFormatSingle,
+				MaxOwners: 1,
+				Holders: []kured.LockHolder{
+					{
+						NodeID:   "kind-worker",
+						Metadata: map[string]interface{}{"unschedulable": true},
+						Created:  time.Date(2024, time.May, 31, 6, 31, 0, 0, time.UTC),
+						TTL:      30 * time.Minute,
+					},
+				},
+			},
+		},
+		{
+			name:            "kured 1.15 multi lock",
+			annotationValue: `{"maxOwners":2,"locks":[{"nodeID":"kind-worker2","metadata":{"unschedulable":false},"created":"2024-05-31T06:31:32.735905893Z","TTL":0},{"nodeID":"kind-control-plane","metadata":{"unschedulable":false},"created":"2024-05-31T06:31:49.868231413Z","TTL":0}]}`,
+			want: &kured.Lock{
+				Format:    kured.LockFormatMulti,
+				MaxOwners: 2,
+				Holders: []kured.LockHolder{
+					{
+						NodeID:   "kind-worker2",
+						Metadata: map[string]interface{}{"unschedulable": false},
+						Created:  time.Date(2024, time.May, 31, 6, 31, 32, 735905893, time.UTC),
+					},
+					{
+						NodeID:   "kind-control-plane",
+						Metadata: map[string]interface{}{"unschedulable": false},
+						Created:  time.Date(2024, time.May, 31, 6, 31, 49, 868231413, time.UTC),
+					},
+				},
+			},
+		},
+		{
+			name:            "kured 1.15 multi lock released",
+			annotationValue: `{"maxOwners":2,"locks":[]}`,
+			want:            &kured.Lock{Format: kured.LockFormatMulti, MaxOwners: 2, Holders: []kured.LockHolder{}},
+		},
+		{
+			name:            "manual lock",
+			annotationValue: `{"nodeID":"manual"}`,
+			want:            &kured.Lock{Format: kured.LockFormatLegacy, MaxOwners: 1, Manual: true, Holders: []kured.LockHolder{}},
+		},
+		{
+			name:            "unknown format",
+			annotationValue: `{"holder":"kind-worker"}`,
+			expectErr:       true,
+		},
+		{
+			name:            "invalid JSON",
+			annotationValue: `{"nodeID":`,
+			expectErr:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lock, err := kured.ParseLockAnnotation(tt.annotationValue)
+			if tt.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, lock)
+		})
+	}
+}
+
+func TestParseLease(t *testing.T) {
+	acquireTime := metav1.NewMicroTime(time.Date(2024, time.May, 31, 6, 31, 0, 0, time.UTC))
+	holder := "kind-worker"
+	manual := kured.ManualLockNodeID
+	empty := ""
+
+	tests := []struct {
+		name  string
+		lease coordinationv1.LeaseSpec
+		want  *kured.Lock
+	}{
+		{
+			name:  "held lease",
+			lease: coordinationv1.LeaseSpec{HolderIdentity: &holder, AcquireTime: &acquireTime},
+			want: &kured.Lock{
+				Format:    kured.LockFormatLease,
+				MaxOwners: 1,
+				Holders:   []kured.LockHolder{{NodeID: "kind-worker", Created: acquireTime.Time}},
+			},
+		},
+		{
+			name:  "released lease",
+			lease: coordinationv1.LeaseSpec{HolderIdentity: &empty},
+			want:  &kured.Lock{Format: kured.LockFormatLease, MaxOwners: 1, Holders: []kured.LockHolder{}},
+		},
+		{
+			name:  "lease without holder",
+			lease: coordinationv1.LeaseSpec{},
+			want:  &kured.Lock{Format: kured.LockFormatLease, MaxOwners: 1, Holders: []kured.LockHolder{}},
+		},
+		{
+			name:  "manual lease",
+			lease: coordinationv1.LeaseSpec{HolderIdentity: &manual},
+			want:  &kured.Lock{Format: kured.LockFormatLease, MaxOwners: 1, Manual: true, Holders: []kured.LockHolder{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, kured.ParseLease(&coordinationv1.Lease{Spec: tt.lease}))
+		})
+	}
+}
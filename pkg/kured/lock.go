@@ -0,0 +1,142 @@
+package kured
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+)
+
+// LockFormat identifies the format in which kured recorded its lock
+type LockFormat string
+
+const (
+	// LockFormatLegacy is the single lock written by kured before 1.7, without creation time nor TTL
+	LockFormatLegacy LockFormat = "legacy"
+	// LockFormatSingle is the single lock written by kured 1.7+ when running with a concurrency of 1
+	LockFormatSingle LockFormat = "single"
+	// LockFormatMulti is the multi lock written by kured 1.11+ when running with a concurrency above 1
+	LockFormatMulti LockFormat = "multi"
+	// LockFormatLease is the lock recorded in a coordination.k8s.io Lease
+	LockFormatLease LockFormat = "lease"
+)
+
+// ManualLockNodeID is the node ID used by administrators to lock kured by hand
+const ManualLockNodeID = "manual"
+
+// lockAnnotationValue mirrors the single lock of "github.com/kubereboot/kured/pkg/daemonsetlock",
+// created and TTL were added in kured 1.7
+type lockAnnotationValue struct {
+	NodeID   string        `json:"nodeID"`
+	Metadata interface{}   `json:"metadata,omitempty"`
+	Created  time.Time     `json:"created"`
+	TTL      time.Duration `json:"TTL"`
+}
+
+// multiLockAnnotationValue mirrors the multi lock of "github.com/kubereboot/kured/pkg/daemonsetlock"
+type multiLockAnnotationValue struct {
+	MaxOwners       int                   `json:"maxOwners"`
+	LockAnnotations []lockAnnotationValue `json:"locks"`
+}
+
+// LockHolder is a node holding the kured lock
+type LockHolder struct {
+	NodeID   string
+	Metadata map[string]interface{}
+	// Created is zero when the lock format does not record it
+	Created time.Time
+	// TTL is zero when kured releases the lock only after the reboot
+	TTL time.Duration
+}
+
+// Lock is the kured lock independently of the format it was recorded in
+type Lock struct {
+	Format LockFormat
+	// MaxOwners is the kured concurrency, 1 for single locks
+	MaxOwners int
+	// Manual is set when an administrator locked kured by hand
+	Manual  bool
+	Holders []LockHolder
+}
+
+func newLockHolder(value lockAnnotationValue) LockHolder {
+	metadata, _ := value.Metadata.(map[string]interface{})
+	return LockHolder{
+		NodeID:   value.NodeID,
+		Metadata: metadata,
+		Created:  value.Created,
+		TTL:      value.TTL,
+	}
+}
+
+// ParseLockAnnotation parses the lock annotation value of any kured release
+func ParseLockAnnotation(value string) (*Lock, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return nil, err
+	}
+
+	_, hasLocks := fields["locks"]
+	_, hasMaxOwners := fields["maxOwners"]
+	_, hasNodeID := fields["nodeID"]
+	_, hasCreated := fields["created"]
+
+	switch {
+	case hasLocks || hasMaxOwners:
+		multiLock := &multiLockAnnotationValue{}
+		if err := json.Unmarshal([]byte(value), multiLock); err != nil {
+			return nil, err
+		}
+
+		lock := &Lock{Format: LockFormatMulti, MaxOwners: multiLock.MaxOwners, Holders: []LockHolder{}}
+		for _, value := range multiLock.LockAnnotations {
+			lock.Holders = append(lock.Holders, newLockHolder(value))
+		}
+		return lock, nil
+
+	case hasNodeID:
+		singleLock := &lockAnnotationValue{}
+		if err := json.Unmarshal([]byte(value), singleLock); err != nil {
+			return nil, err
+		}
+
+		lock := &Lock{Format: LockFormatSingle, MaxOwners: 1, Holders: []LockHolder{}}
+		if !hasCreated {
+			lock.Format = LockFormatLegacy
+		}
+
+		switch singleLock.NodeID {
+		case ManualLockNodeID:
+			lock.Manual = true
+		case "":
+		default:
+			lock.Holders = append(lock.Holders, newLockHolder(*singleLock))
+		}
+		return lock, nil
+
+	default:
+		return nil, fmt.Errorf("unknown kured lock format: %s", value)
+	}
+}
+
+// ParseLease converts a kured Lease into a lock, a Lease without holder is a released lock
+func ParseLease(lease *coordinationv1.Lease) *Lock {
+	lock := &Lock{Format: LockFormatLease, MaxOwners: 1, Holders: []LockHolder{}}
+
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == "" {
+		return lock
+	}
+
+	if *lease.Spec.HolderIdentity == ManualLockNodeID {
+		lock.Manual = true
+		return lock
+	}
+
+	holder := LockHolder{NodeID: *lease.Spec.HolderIdentity}
+	if lease.Spec.AcquireTime != nil {
+		holder.Created = lease.Spec.AcquireTime.Time
+	}
+	lock.Holders = append(lock.Holders, holder)
+	return lock
+}
@@ -0,0 +1,153 @@
+package kured
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// KuredRebootInProgressAnnotation is the annotation kured sets on a node from drain until the node is back, with --annotate-nodes
+const KuredRebootInProgressAnnotation string = "weave.works/kured-reboot-in-progress"
+
+// NodeRebootDetector detects rebooting nodes from their state, as a fallback when the kured lock is missed
+type NodeRebootDetector struct {
+	annotation string
+
+	mu      sync.Mutex
+	windows map[string]SilenceNode
+	// firstSeen records when the reboot in progress annotations with an unexpected value were first seen
+	firstSeen map[string]time.Time
+}
+
+func NewNodeRebootDetector(annotation string) *NodeRebootDetector {
+	return &NodeRebootDetector{
+		annotation: annotation,
+		windows:    map[string]SilenceNode{},
+		firstSeen:  map[string]time.Time{},
+	}
+}
+
+// RecordWindows records the reboot windows derived from the kured lock
+func (d *NodeRebootDetector) RecordWindows(silenceNodes []SilenceNode) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, silenceNode := range silenceNodes {
+		if known, ok := d.windows[silenceNode.NodeID]; !ok || silenceNode.SilenceEnd.After(known.SilenceEnd) {
+			d.windows[silenceNode.NodeID] = silenceNode
+		}
+	}
+}
+
+// ActiveWindows returns the recorded reboot windows that are still active, sorted by node
+func (d *NodeRebootDetector) ActiveWindows(nowProvider TimeProvider) []SilenceNode {
+	now := nowProvider()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	silenceNodes := []SilenceNode{}
+	for nodeName, window := range d.windows {
+		if !window.SilenceEnd.After(now) {
+			delete(d.windows, nodeName)
+			continue
+		}
+		silenceNodes = append(silenceNodes, window)
+	}
+	sort.Slice(silenceNodes, func(i, j int) bool {
+		return silenceNodes[i].NodeID < silenceNodes[j].NodeID
+	})
+	return silenceNodes
+}
+
+// knownWindow returns the recorded reboot window of the node when it is still active
+func (d *NodeRebootDetector) knownWindow(nodeName string, now time.Time) (SilenceNode, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	window, ok := d.windows[nodeName]
+	if !ok {
+		return SilenceNode{}, false
+	}
+	if !window.SilenceEnd.After(now) {
+		delete(d.windows, nodeName)
+		return SilenceNode{}, false
+	}
+	return window, true
+}
+
+// ExtractRebootingNode returns the silence for a node that kured is rebooting according to the node state:
+// cordoned or NotReady with the kured reboot in progress annotation, or NotReady during a known reboot window
+func (d *NodeRebootDetector) ExtractRebootingNode(node *corev1.Node, window SilenceWindow, nowProvider TimeProvider) (SilenceNode, bool) {
+	now := nowProvider()
+
+	inProgress, ok := node.Annotations[d.annotation]
+	if ok && (nodeCordoned(node) || !nodeReady(node)) {
+		// kured records the time the reboot started, fallback to the first time it is seen for unexpected values
+		created, err := time.Parse(time.RFC3339, inProgress)
+		if err != nil {
+			created = d.annotationFirstSeen(node.Name, now)
+		}
+
+		silenceNode := window.silenceNode(LockHolder{NodeID: node.Name, Created: created}, now)
+		if silenceNode.SilenceEnd.After(now) {
+			return silenceNode, true
+		}
+	}
+
+	if !ok {
+		d.forgetAnnotation(node.Name)
+	}
+
+	if !nodeReady(node) {
+		return d.knownWindow(node.Name, now)
+	}
+
+	return SilenceNode{}, false
+}
+
+// annotationFirstSeen returns when the reboot in progress annotation of the node was first seen
+func (d *NodeRebootDetector) annotationFirstSeen(nodeName string, now time.Time) time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	firstSeen, ok := d.firstSeen[nodeName]
+	if !ok {
+		firstSeen = now
+		d.firstSeen[nodeName] = firstSeen
+	}
+	return firstSeen
+}
+
+// forgetAnnotation forgets the reboot in progress annotation of the node once kured removed it
+func (d *NodeRebootDetector) forgetAnnotation(nodeName string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.firstSeen, nodeName)
+}
+
+// nodeCordoned reports whether the node is unschedulable
+func nodeCordoned(node *corev1.Node) bool {
+	if node.Spec.Unschedulable {
+		return true
+	}
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == corev1.TaintNodeUnschedulable {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeReady reports whether the node Ready condition is true
+func nodeReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package kured_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/trustyou/kured-alert-silencer/pkg/kured"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNodeRebootDetector(t *testing.T) {
+	fixedTime := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	timeProvider := func() time.Time {
+		return fixedTime
+	}
+	window := kured.SilenceWindow{Duration: time.Hour}
+	rebootStarted := time.Date(2024, time.May, 31, 6, 31, 0, 0, time.UTC)
+
+	newNode := func(annotations map[string]string, unschedulable bool, taints []corev1.Taint, ready corev1.ConditionStatus) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "kind-worker", Annotations: annotations},
+			Spec:       corev1.NodeSpec{Unschedulable: unschedulable, Taints: taints},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}},
+			},
+		}
+	}
+	inProgress := map[string]string{kured.KuredRebootInProgressAnnotation: "2024-05-31T06:31:00Z"}
+	unschedulableTaint := []corev1.Taint{{Key: corev1.TaintNodeUnschedulable, Effect: corev1.TaintEffectNoSchedule}}
+
+	tests := []struct {
+		name    string
+		node    *corev1.Node
+		windows []kured.SilenceNode
+		want    kured.SilenceNode
+		wantOk  bool
+	}{
+		{
+			name:   "ready and schedulable",
+			node:   newNode(nil, false, nil, corev1.ConditionTrue),
+			wantOk: false,
+		},
+		{
+			name:   "cordoned by an administrator",
+			node:   newNode(nil, true, nil, corev1.ConditionTrue),
+			wantOk: false,
+		},
+		{
+			name:   "cordoned by kured",
+			node:   newNode(inProgress, true, nil, corev1.ConditionTrue),
+			want:   kured.SilenceNode{NodeID: "kind-worker", LockCreated: rebootStarted, SilenceStart: rebootStarted, SilenceEnd: rebootStarted.Add(time.Hour)},
+			wantOk: true,
+		},
+		{
+			name:   "tainted by kured",
+			node:   newNode(inProgress, false, unschedulableTaint, corev1.ConditionTrue),
+			want:   kured.SilenceNode{NodeID: "kind-worker", LockCreated: rebootStarted, SilenceStart: rebootStarted, SilenceEnd: rebootStarted.Add(time.Hour)},
+			wantOk: true,
+		},
+		{
+			name:   "rebooting with unexpected annotation value",
+			node:   newNode(map[string]string{kured.KuredRebootInProgressAnnotation: "true"}, false, nil, corev1.ConditionFalse),
+			want:   kured.SilenceNode{NodeID: "kind-worker", LockCreated: fixedTime, SilenceStart: fixedTime, SilenceEnd: fixedTime.Add(time.Hour)},
+			wantOk: true,
+		},
+		{
+			name:   "reboot in progress for too long",
+			node:   newNode(map[string]string{kured.KuredRebootInProgressAnnotation: "2024-05-31T04:00:00Z"}, true, nil, corev1.ConditionTrue),
+			wantOk: false,
+		},
+		{
+			name:   "not ready outside of a reboot window",
+			node:   newNode(nil, false, nil, corev1.ConditionUnknown),
+			wantOk: false,
+		},
+		{
+			name: "not ready during a known reboot window",
+			node: newNode(nil, false, nil, corev1.ConditionUnknown),
+			windows: []kured.SilenceNode{
+				{NodeID: "kind-worker", LockCreated: rebootStarted, SilenceStart: rebootStarted, SilenceEnd: rebootStarted.Add(time.Hour)},
+			},
+			want:   kured.SilenceNode{NodeID: "kind-worker", LockCreated: rebootStarted, SilenceStart: rebootStarted, SilenceEnd: rebootStarted.Add(time.Hour)},
+			wantOk: true,
+		},
+		{
+			name: "not ready after a known reboot window",
+			node: newNode(nil, false, nil, corev1.ConditionFalse),
+			windows: []kured.SilenceNode{
+				{NodeID: "kind-worker", LockCreated: rebootStarted, SilenceStart: rebootStarted, SilenceEnd: rebootStarted.Add(time.Minute)},
+			},
+			wantOk: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detector := kured.NewNodeRebootDetector(kured.KuredRebootInProgressAnnotation)
+			detector.RecordWindows(tt.windows)
+
+			result, ok := detector.ExtractRebootingNode(tt.node, window, timeProvider)
+			require.Equal(t, tt.wantOk, ok)
+			if tt.wantOk {
+				require.Equal(t, tt.want, result)
+			}
+		})
+	}
+}
+
+func TestNodeRebootDetectorUnexpectedAnnotation(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	timeProvider := func() time.Time {
+		return now
+	}
+	window := kured.SilenceWindow{Duration: time.Hour}
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "kind-worker", Annotations: map[string]string{kured.KuredRebootInProgressAnnotation: "true"}},
+		Spec:       corev1.NodeSpec{Unschedulable: true},
+	}
+	detector := kured.NewNodeRebootDetector(kured.KuredRebootInProgressAnnotation)
+
+	firstSeen := now
+	result, ok := detector.ExtractRebootingNode(node, window, timeProvider)
+	require.True(t, ok)
+	require.Equal(t, firstSeen.Add(time.Hour), result.SilenceEnd)
+
+	// the window does not move with the following node updates and ends
+	now = now.Add(50 * time.Minute)
+	result, ok = detector.ExtractRebootingNode(node, window, timeProvider)
+	require.True(t, ok)
+	require.Equal(t, firstSeen.Add(time.Hour), result.SilenceEnd)
+	now = now.Add(10 * time.Minute)
+	_, ok = detector.ExtractRebootingNode(node, window, timeProvider)
+	require.False(t, ok)
+
+	// the annotation of the next reboot starts a new window
+	ready := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "kind-worker"}, Status: corev1.NodeStatus{
+		Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+	}}
+	_, ok = detector.ExtractRebootingNode(ready, window, timeProvider)
+	require.False(t, ok)
+	result, ok = detector.ExtractRebootingNode(node, window, timeProvider)
+	require.True(t, ok)
+	require.Equal(t, now.Add(time.Hour), result.SilenceEnd)
+}
+
+func TestNodeRebootDetectorActiveWindows(t *testing.T) {
+	fixedTime := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	timeProvider := func() time.Time {
+		return fixedTime
+	}
+	rebootStarted := time.Date(2024, time.May, 31, 6, 31, 0, 0, time.UTC)
+
+	detector := kured.NewNodeRebootDetector(kured.KuredRebootInProgressAnnotation)
+	detector.RecordWindows([]kured.SilenceNode{
+		{NodeID: "kind-worker2", SilenceStart: rebootStarted, SilenceEnd: rebootStarted.Add(time.Hour)},
+		{NodeID: "kind-worker3", SilenceStart: rebootStarted, SilenceEnd: rebootStarted.Add(time.Minute)},
+		{NodeID: "kind-worker", SilenceStart: rebootStarted, SilenceEnd: rebootStarted.Add(time.Hour)},
+	})
+
+	windows := detector.ActiveWindows(timeProvider)
+	require.Len(t, windows, 2)
+	require.Equal(t, "kind-worker", windows[0].NodeID)
+	require.Equal(t, "kind-worker2", windows[1].NodeID)
+}
@@ -0,0 +1,120 @@
+package kured
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// KuredRebootRequiredMetric is the gauge exposed by kured, set to 1 while the node requires a reboot
+const KuredRebootRequiredMetric string = "kured_reboot_required"
+
+// RebootRequiredNodesFromMetrics returns the nodes requiring a reboot according to the kured metrics in Prometheus text format
+func RebootRequiredNodesFromMetrics(r io.Reader) ([]string, error) {
+	parser := expfmt.NewTextParser(model.UTF8Validation)
+	families, err := parser.TextToMetricFamilies(r)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []string{}
+	family, ok := families[KuredRebootRequiredMetric]
+	if !ok {
+		return nodes, nil
+	}
+
+	for _, metric := range family.GetMetric() {
+		if metric.GetGauge().GetValue() != 1 {
+			continue
+		}
+		for _, label := range metric.GetLabel() {
+			if label.GetName() == "node" && label.GetValue() != "" {
+				nodes = append(nodes, label.GetValue())
+			}
+		}
+	}
+
+	sort.Strings(nodes)
+	return nodes, nil
+}
+
+// RebootRequiredNode reports whether the node carries the given reboot required label or annotation
+func RebootRequiredNode(node *corev1.Node, key string) bool {
+	if _, ok := node.Labels[key]; ok {
+		return true
+	}
+	_, ok := node.Annotations[key]
+	return ok
+}
+
+// RebootRequiredTracker remembers since when nodes require a reboot, so pending reboot
+// silences keep the same window while the reboot is pending
+type RebootRequiredTracker struct {
+	mu    sync.Mutex
+	since map[string]time.Time
+}
+
+func NewRebootRequiredTracker() *RebootRequiredTracker {
+	return &RebootRequiredTracker{since: map[string]time.Time{}}
+}
+
+// ExtractPendingNode returns the pending reboot silence of a node, starting when the reboot was first required
+func (r *RebootRequiredTracker) ExtractPendingNode(nodeName string, required bool, duration time.Duration, nowProvider TimeProvider) (SilenceNode, bool) {
+	now := nowProvider()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !required {
+		delete(r.since, nodeName)
+		return SilenceNode{}, false
+	}
+
+	since, ok := r.since[nodeName]
+	if !ok {
+		since = now
+		r.since[nodeName] = since
+	}
+
+	silenceNode := SilenceNode{
+		NodeID:       nodeName,
+		SilenceStart: since,
+		SilenceEnd:   since.Add(duration),
+	}
+	return silenceNode, silenceNode.SilenceEnd.After(now)
+}
+
+// ExtractPendingNodes returns the pending reboot silences of the nodes requiring a reboot, forgetting the other nodes
+func (r *RebootRequiredTracker) ExtractPendingNodes(nodeNames []string, duration time.Duration, nowProvider TimeProvider) []SilenceNode {
+	required := map[string]bool{}
+	for _, nodeName := range nodeNames {
+		required[nodeName] = true
+	}
+
+	r.mu.Lock()
+	known := []string{}
+	for nodeName := range r.since {
+		known = append(known, nodeName)
+	}
+	r.mu.Unlock()
+
+	for _, nodeName := range known {
+		if !required[nodeName] {
+			r.ExtractPendingNode(nodeName, false, duration, nowProvider)
+		}
+	}
+
+	silencerArray := []SilenceNode{}
+	for _, nodeName := range nodeNames {
+		if silenceNode, ok := r.ExtractPendingNode(nodeName, true, duration, nowProvider); ok {
+			silencerArray = append(silencerArray, silenceNode)
+		}
+	}
+	return silencerArray
+}
@@ -0,0 +1,98 @@
+package kured_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/trustyou/kured-alert-silencer/pkg/kured"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRebootRequiredNodesFromMetrics(t *testing.T) {
+	tests := []struct {
+		name      string
+		metrics   string
+		want      []string
+		expectErr bool
+	}{
+		{
+			name: "kured metrics",
+			metrics: `# HELP kured_reboot_required OS requires reboot due to software updates.
+# TYPE kured_reboot_required gauge
+kured_reboot_required{node="kind-worker2"} 1
+kured_reboot_required{node="kind-control-plane"} 0
+kured_reboot_required{node="kind-worker"} 1
+# HELP go_goroutines Number of goroutines that currently exist.
+# TYPE go_goroutines gauge
+go_goroutines 12
+`,
+			want: []string{"kind-worker", "kind-worker2"},
+		},
+		{
+			name:    "no kured metric",
+			metrics: "go_goroutines 12\n",
+			want:    []string{},
+		},
+		{
+			name:      "invalid metrics",
+			metrics:   "kured_reboot_required{node=kind-worker} 1\n",
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, err := kured.RebootRequiredNodesFromMetrics(strings.NewReader(tt.metrics))
+			if tt.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, nodes)
+		})
+	}
+}
+
+func TestRebootRequiredNode(t *testing.T) {
+	const key = "example.com/reboot-required"
+
+	require.True(t, kured.RebootRequiredNode(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{key: "true"}}}, key))
+	require.True(t, kured.RebootRequiredNode(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{key: ""}}}, key))
+	require.False(t, kured.RebootRequiredNode(&corev1.Node{}, key))
+}
+
+func TestRebootRequiredTracker(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 0, 0, 0, time.UTC)
+	timeProvider := func() time.Time {
+		return now
+	}
+	tracker := kured.NewRebootRequiredTracker()
+
+	result := tracker.ExtractPendingNodes([]string{"kind-worker"}, 30*time.Minute, timeProvider)
+	require.Equal(t, []kured.SilenceNode{
+		{NodeID: "kind-worker", SilenceStart: now, SilenceEnd: now.Add(30 * time.Minute)},
+	}, result)
+
+	// the silence window does not move while the reboot is pending
+	firstSeen := now
+	now = now.Add(10 * time.Minute)
+	result = tracker.ExtractPendingNodes([]string{"kind-worker", "kind-worker2"}, 30*time.Minute, timeProvider)
+	require.Equal(t, []kured.SilenceNode{
+		{NodeID: "kind-worker", SilenceStart: firstSeen, SilenceEnd: firstSeen.Add(30 * time.Minute)},
+		{NodeID: "kind-worker2", SilenceStart: now, SilenceEnd: now.Add(30 * time.Minute)},
+	}, result)
+
+	// the silence is not renewed when the reboot stays pending for too long
+	now = firstSeen.Add(time.Hour)
+	result = tracker.ExtractPendingNodes([]string{"kind-worker"}, 30*time.Minute, timeProvider)
+	require.Equal(t, []kured.SilenceNode{}, result)
+
+	// a new pending reboot starts a new window
+	tracker.ExtractPendingNodes([]string{}, 30*time.Minute, timeProvider)
+	_, pending := tracker.ExtractPendingNode("kind-worker", true, 30*time.Minute, timeProvider)
+	require.True(t, pending)
+}
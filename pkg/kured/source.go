@@ -0,0 +1,113 @@
+package kured
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// LockSourceDaemonSet reads the lock from the kured DaemonSet annotation
+	LockSourceDaemonSet = "daemonset"
+	// LockSourceLease reads the lock from a coordination.k8s.io Lease
+	LockSourceLease = "lease"
+)
+
+// LockSource is the Kubernetes object on which kured records its lock
+type LockSource interface {
+	// Watch starts watching the lock object
+	Watch(ctx context.Context) (watch.Interface, error)
+	// Get reads the current lock object
+	Get(ctx context.Context) (runtime.Object, error)
+	// Lock extracts the kured lock from an object sent by the watcher
+	Lock(obj runtime.Object) (*Lock, error)
+	// String describes the lock object for logging
+	String() string
+}
+
+// DaemonSetLockSource reads the kured lock from an annotation of the kured DaemonSet
+type DaemonSetLockSource struct {
+	client     kubernetes.Interface
+	namespace  string
+	name       string
+	annotation string
+}
+
+func NewDaemonSetLockSource(client kubernetes.Interface, namespace string, name string, annotation string) *DaemonSetLockSource {
+	return &DaemonSetLockSource{
+		client:     client,
+		namespace:  namespace,
+		name:       name,
+		annotation: annotation,
+	}
+}
+
+func (s *DaemonSetLockSource) Watch(ctx context.Context) (watch.Interface, error) {
+	return s.client.AppsV1().DaemonSets(s.namespace).Watch(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", s.name).String(),
+	})
+}
+
+func (s *DaemonSetLockSource) Get(ctx context.Context) (runtime.Object, error) {
+	return s.client.AppsV1().DaemonSets(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+}
+
+func (s *DaemonSetLockSource) Lock(obj runtime.Object) (*Lock, error) {
+	ds, ok := obj.(*appsv1.DaemonSet)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object %T, expected DaemonSet", obj)
+	}
+
+	if _, ok := ds.Annotations[s.annotation]; !ok {
+		return &Lock{Holders: []LockHolder{}}, nil
+	}
+	return ParseLockAnnotation(ds.Annotations[s.annotation])
+}
+
+func (s *DaemonSetLockSource) String() string {
+	return fmt.Sprintf("DaemonSet %s/%s annotation %s", s.namespace, s.name, s.annotation)
+}
+
+// LeaseLockSource reads the kured lock from a coordination.k8s.io Lease
+type LeaseLockSource struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+func NewLeaseLockSource(client kubernetes.Interface, namespace string, name string) *LeaseLockSource {
+	return &LeaseLockSource{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+func (s *LeaseLockSource) Watch(ctx context.Context) (watch.Interface, error) {
+	return s.client.CoordinationV1().Leases(s.namespace).Watch(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", s.name).String(),
+	})
+}
+
+func (s *LeaseLockSource) Get(ctx context.Context) (runtime.Object, error) {
+	return s.client.CoordinationV1().Leases(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+}
+
+func (s *LeaseLockSource) Lock(obj runtime.Object) (*Lock, error) {
+	lease, ok := obj.(*coordinationv1.Lease)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object %T, expected Lease", obj)
+	}
+	return ParseLease(lease), nil
+}
+
+func (s *LeaseLockSource) String() string {
+	return fmt.Sprintf("Lease %s/%s", s.namespace, s.name)
+}
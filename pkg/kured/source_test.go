@@ -0,0 +1,101 @@
+package kured_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/trustyou/kured-alert-silencer/pkg/kured"
+
+	appsv1 "k8s.io/api/apps/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDaemonSetLockSource(t *testing.T) {
+	const KuredNodeLockAnnotation string = "weave.works/kured-node-lock"
+
+	client := fake.NewSimpleClientset()
+	source := kured.NewDaemonSetLockSource(client, "kube-system", "kured", KuredNodeLockAnnotation)
+
+	watcher, err := source.Watch(context.Background())
+	require.NoError(t, err)
+	defer watcher.Stop()
+
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "kured",
+			Namespace: "kube-system",
+			Annotations: map[string]string{
+				KuredNodeLockAnnotation: `{"nodeID":"kind-worker","metadata":{"unschedulable":false},"created":"2024-05-31T06:31:00Z","TTL":0}`,
+			},
+		},
+	}
+	_, err = client.AppsV1().DaemonSets("kube-system").Create(context.Background(), ds, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	event := <-watcher.ResultChan()
+	require.Equal(t, watch.Added, event.Type)
+
+	lock, err := source.Lock(event.Object)
+	require.NoError(t, err)
+	require.Equal(t, kured.LockFormatSingle, lock.Format)
+	require.Equal(t, "kind-worker", lock.Holders[0].NodeID)
+
+	obj, err := source.Get(context.Background())
+	require.NoError(t, err)
+	lock, err = source.Lock(obj)
+	require.NoError(t, err)
+	require.Equal(t, "kind-worker", lock.Holders[0].NodeID)
+
+	lock, err = source.Lock(&appsv1.DaemonSet{})
+	require.NoError(t, err)
+	require.Empty(t, lock.Holders)
+
+	_, err = source.Lock(&coordinationv1.Lease{})
+	require.Error(t, err)
+}
+
+func TestLeaseLockSource(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	source := kured.NewLeaseLockSource(client, "kube-system", "kured")
+
+	watcher, err := source.Watch(context.Background())
+	require.NoError(t, err)
+	defer watcher.Stop()
+
+	holder := "kind-worker"
+	acquireTime := metav1.NewMicroTime(time.Date(2024, time.May, 31, 6, 31, 0, 0, time.UTC))
+	lease := &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "kured",
+			Namespace: "kube-system",
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity: &holder,
+			AcquireTime:    &acquireTime,
+		},
+	}
+	_, err = client.CoordinationV1().Leases("kube-system").Create(context.Background(), lease, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	event := <-watcher.ResultChan()
+	require.Equal(t, watch.Added, event.Type)
+
+	lock, err := source.Lock(event.Object)
+	require.NoError(t, err)
+	require.Equal(t, kured.LockFormatLease, lock.Format)
+	require.Equal(t, []kured.LockHolder{{NodeID: "kind-worker", Created: acquireTime.Time}}, lock.Holders)
+
+	obj, err := source.Get(context.Background())
+	require.NoError(t, err)
+	lock, err = source.Lock(obj)
+	require.NoError(t, err)
+	require.Equal(t, "kind-worker", lock.Holders[0].NodeID)
+
+	_, err = source.Lock(&appsv1.DaemonSet{})
+	require.Error(t, err)
+}
@@ -0,0 +1,52 @@
+package silence
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/smithy-go/ptr"
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/alertmanager/pkg/labels"
+)
+
+// ParseExclusions parses exclusion matchers in the Alertmanager matcher syntax, e.g.
+// `{severity!="critical", alertname!="Watchdog"}`, appended to every silence so that the excluded alerts still fire.
+// Only negative matchers are accepted, as a positive matcher would not exclude alerts but restrict the silence
+func ParseExclusions(value string) ([]*models.Matcher, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	parsed, err := labels.ParseMatchers(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exclusion matchers %s: %w", value, err)
+	}
+
+	exclusions := []*models.Matcher{}
+	for _, matcher := range parsed {
+		if matcher.Type != labels.MatchNotEqual && matcher.Type != labels.MatchNotRegexp {
+			return nil, fmt.Errorf("exclusion matcher %s is not negative, use != or !~", matcher)
+		}
+		exclusions = append(exclusions, &models.Matcher{
+			Name:    ptr.String(matcher.Name),
+			Value:   ptr.String(matcher.Value),
+			IsRegex: ptr.Bool(matcher.Type == labels.MatchNotRegexp),
+			IsEqual: ptr.Bool(false),
+		})
+	}
+	return exclusions, nil
+}
+
+// MergeExclusions returns the exclusion matchers of both lists, dropping the duplicates
+func MergeExclusions(exclusions []*models.Matcher, more []*models.Matcher) []*models.Matcher {
+	merged := []*models.Matcher{}
+	seen := map[string]bool{}
+	for _, matcher := range append(append([]*models.Matcher{}, exclusions...), more...) {
+		if seen[matcherString(matcher)] {
+			continue
+		}
+		seen[matcherString(matcher)] = true
+		merged = append(merged, matcher)
+	}
+	return merged
+}
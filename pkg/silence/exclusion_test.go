@@ -0,0 +1,78 @@
+package silence
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExclusions(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		want      string
+		expectErr bool
+	}{
+		{name: "Empty", value: "", want: "{}"},
+		{name: "Braces", value: `{severity!="critical", alertname!="Watchdog"}`, want: `{alertname!="Watchdog", severity!="critical"}`},
+		{name: "No braces", value: `severity!="critical",alertname!~"Watchdog|InfoInhibitor"`, want: `{alertname!~"Watchdog|InfoInhibitor", severity!="critical"}`},
+		{name: "Positive matcher", value: `severity="warning"`, expectErr: true},
+		{name: "Positive regex matcher", value: `severity=~"warning|info"`, expectErr: true},
+		{name: "Invalid regex", value: `alertname!~"("`, expectErr: true},
+		{name: "Invalid syntax", value: `severity!!"critical"`, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exclusions, err := ParseExclusions(tt.value)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, silenceKey(exclusions))
+		})
+	}
+}
+
+func TestSilenceAlertsExclusions(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	silencer := NewFakeSilencer(func() time.Time {
+		return now
+	})
+
+	exclusions, err := ParseExclusions(`{severity!="critical", alertname!="Watchdog"}`)
+	require.NoError(t, err)
+	config := Config{
+		MatchersJSON:    `[{"name": "instance", "value": "{{.NodeName}}", "isRegex": false}, {"matchers": [{"name": "node", "value": "{{.NodeName}}", "isRegex": false}, {"name": "severity", "value": "critical", "isRegex": false, "isEqual": false}]}]`,
+		CreatedBy:       DefaultCreatedBy,
+		CommentTemplate: DefaultCommentTemplate,
+		Exclusions:      MergeExclusions(exclusions, exclusions),
+	}
+	require.Error(t, config.Validate(TemplateData{}, time.Minute, 24*time.Hour), "mixed matchers and groups are rejected")
+
+	config.MatchersJSON = `[{"matchers": [{"name": "instance", "value": "{{.NodeName}}", "isRegex": false}]}, {"matchers": [{"name": "node", "value": "{{.NodeName}}", "isRegex": false}, {"name": "severity", "value": "critical", "isRegex": false, "isEqual": false}]}]`
+	require.NoError(t, config.Validate(TemplateData{}, time.Minute, 24*time.Hour))
+
+	_, err = SilenceAlerts(context.Background(), silencer, config, TemplateData{NodeName: "node1"}, now, now, now.Add(time.Hour))
+	require.NoError(t, err)
+
+	keys := []string{}
+	for _, s := range silencer.Silences() {
+		keys = append(keys, silenceKey(s.Matchers))
+	}
+	// the exclusions are appended once to every silence
+	want := []string{
+		`{alertname!="Watchdog", instance="node1", severity!="critical"}`,
+		`{alertname!="Watchdog", node="node1", severity!="critical"}`,
+	}
+	assert.ElementsMatch(t, want, keys)
+
+	// the cleanup expects the silences with their exclusions
+	expected, err := SilenceKeys(config, TemplateData{NodeName: "node1"})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, want, expected)
+}
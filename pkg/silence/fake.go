@@ -0,0 +1,141 @@
+package silence
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+)
+
+// FakeSilencer is an in-memory Silencer for tests, following the Alertmanager semantics: silences created with a
+// start in the past start now
+type FakeSilencer struct {
+	nowProvider func() time.Time
+
+	mu       sync.Mutex
+	err      error
+	silences []Silence
+}
+
+// NewFakeSilencer creates an empty FakeSilencer, nowProvider decides the state of the silences
+func NewFakeSilencer(nowProvider func() time.Time) *FakeSilencer {
+	return &FakeSilencer{nowProvider: nowProvider}
+}
+
+// SetError makes every following call fail with the error wrapped like the Alertmanager ones, or succeed when nil
+func (f *FakeSilencer) SetError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.err = err
+}
+
+// Silences returns every silence in creation order, including the expired ones
+func (f *FakeSilencer) Silences() []Silence {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	silences := []Silence{}
+	for _, s := range f.silences {
+		silences = append(silences, f.withState(s))
+	}
+	return silences
+}
+
+// withState sets the state of the silence at the current time
+func (f *FakeSilencer) withState(s Silence) Silence {
+	now := f.nowProvider()
+	switch {
+	case !s.EndsAt.After(now):
+		s.State = models.SilenceStatusStateExpired
+	case s.StartsAt.After(now):
+		s.State = models.SilenceStatusStatePending
+	default:
+		s.State = models.SilenceStatusStateActive
+	}
+	return s
+}
+
+// failure returns the configured error, the caller holds the lock
+func (f *FakeSilencer) failure() error {
+	if f.err != nil {
+		return alertmanagerError(f.err)
+	}
+	return nil
+}
+
+func (f *FakeSilencer) ListSilences(ctx context.Context, matchers []*models.Matcher) ([]Silence, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.failure(); err != nil {
+		return nil, err
+	}
+
+	silences := []Silence{}
+	for _, s := range f.silences {
+		if hasMatchers(s, matchers) {
+			silences = append(silences, f.withState(s))
+		}
+	}
+	return silences, nil
+}
+
+func (f *FakeSilencer) CreateSilence(ctx context.Context, s Silence) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.failure(); err != nil {
+		return "", err
+	}
+
+	s.ID = fmt.Sprintf("00000000-0000-0000-0000-%012d", len(f.silences)+1)
+	s.State = ""
+	// Alertmanager starts a silence created with a start in the past now
+	if now := f.nowProvider(); s.StartsAt.Before(now) {
+		s.StartsAt = now
+	}
+	f.silences = append(f.silences, s)
+	return s.ID, nil
+}
+
+func (f *FakeSilencer) UpdateSilence(ctx context.Context, s Silence) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.failure(); err != nil {
+		return err
+	}
+
+	for i := range f.silences {
+		if f.silences[i].ID == s.ID {
+			s.State = ""
+			f.silences[i] = s
+			return nil
+		}
+	}
+	return fmt.Errorf("silence %s not found", s.ID)
+}
+
+func (f *FakeSilencer) ExpireSilence(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.failure(); err != nil {
+		return err
+	}
+
+	for i := range f.silences {
+		if f.silences[i].ID == id {
+			now := f.nowProvider()
+			if f.silences[i].StartsAt.After(now) {
+				f.silences[i].StartsAt = now
+			}
+			f.silences[i].EndsAt = now
+			return nil
+		}
+	}
+	return fmt.Errorf("silence %s not found", id)
+}
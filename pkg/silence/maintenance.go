@@ -0,0 +1,147 @@
+package silence
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/smithy-go/ptr"
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/alertmanager/pkg/labels"
+)
+
+// maintenance windows have no matchers, the silence attribution and matchers are kept in their description
+const (
+	maintenanceCreatedByPrefix = "created by: "
+	maintenanceMatchersPrefix  = "matchers: "
+)
+
+// maintenanceDescription returns the description of the maintenance window of the silence
+func maintenanceDescription(s Silence) string {
+	return strings.Join([]string{
+		s.Comment,
+		maintenanceCreatedByPrefix + s.CreatedBy,
+		maintenanceMatchersPrefix + matchersString(s.Matchers),
+	}, "\n")
+}
+
+// parseMaintenanceDescription sets the comment, attribution and matchers of the silence from the description of its
+// maintenance window, windows created by someone else have no matchers
+func parseMaintenanceDescription(s *Silence, description string) {
+	comment := []string{}
+	for _, line := range strings.Split(description, "\n") {
+		switch {
+		case strings.HasPrefix(line, maintenanceCreatedByPrefix):
+			s.CreatedBy = strings.TrimPrefix(line, maintenanceCreatedByPrefix)
+		case strings.HasPrefix(line, maintenanceMatchersPrefix):
+			matchers, err := labels.ParseMatchers(strings.TrimPrefix(line, maintenanceMatchersPrefix))
+			if err != nil {
+				comment = append(comment, line)
+				continue
+			}
+			s.Matchers = []*models.Matcher{}
+			for _, matcher := range matchers {
+				s.Matchers = append(s.Matchers, &models.Matcher{
+					Name:    ptr.String(matcher.Name),
+					Value:   ptr.String(matcher.Value),
+					IsRegex: ptr.Bool(matcher.Type == labels.MatchRegexp || matcher.Type == labels.MatchNotRegexp),
+					IsEqual: ptr.Bool(matcher.Type == labels.MatchEqual || matcher.Type == labels.MatchRegexp),
+				})
+			}
+		default:
+			comment = append(comment, line)
+		}
+	}
+	s.Comment = strings.Join(comment, "\n")
+}
+
+// maintenanceState returns the state of a maintenance window at the given time
+func maintenanceState(now time.Time, start time.Time, end time.Time) string {
+	switch {
+	case !end.After(now):
+		return models.SilenceStatusStateExpired
+	case start.After(now):
+		return models.SilenceStatusStatePending
+	default:
+		return models.SilenceStatusStateActive
+	}
+}
+
+// maintenanceError wraps a maintenance window API error with ErrMaintenance and marks it with ErrRetryable
+func maintenanceError(err error) error {
+	return retryableError{fmt.Errorf("%w: %w", ErrMaintenance, err)}
+}
+
+// maintenanceAPI sends JSON requests to a maintenance window API, wrapping its network errors, rate limits and
+// server errors with maintenanceError so that they are retried. Invalid requests and credentials fail right away
+type maintenanceAPI struct {
+	client  *http.Client
+	baseURL string
+	// auth sets the credentials of a request
+	auth func(r *http.Request) error
+}
+
+func newMaintenanceAPI(baseURL string, timeout time.Duration, auth func(r *http.Request) error) *maintenanceAPI {
+	return &maintenanceAPI{
+		client:  &http.Client{Timeout: timeout},
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		auth:    auth,
+	}
+}
+
+// do sends the request with the JSON encoded body, and decodes the JSON response into result when not nil
+func (m *maintenanceAPI) do(ctx context.Context, method string, path string, query url.Values, body any, result any) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	requestURL := m.baseURL + path
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if err := m.auth(req); err != nil {
+		return err
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return maintenanceError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err := fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(message)))
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return maintenanceError(err)
+		}
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+	// a response failing to decode is most likely cut short
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return maintenanceError(err)
+	}
+	return nil
+}
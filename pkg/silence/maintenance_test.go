@@ -0,0 +1,78 @@
+package silence
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMaintenanceDescription(t *testing.T) {
+	s := Silence{}
+	parseMaintenanceDescription(&s, "planned by hand")
+	assert.Equal(t, Silence{Comment: "planned by hand"}, s)
+
+	s = Silence{}
+	parseMaintenanceDescription(&s, "reboot\ncreated by: someone\nmatchers: {instance=~\"kind-.*\", job!=\"node\"}")
+	assert.Equal(t, "reboot", s.Comment)
+	assert.Equal(t, "someone", s.CreatedBy)
+	assert.Equal(t, `{instance=~"kind-.*", job!="node"}`, matchersString(s.Matchers))
+}
+
+func TestMaintenanceAPIErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		auth      error
+		retryable bool
+	}{
+		{name: "ok", status: http.StatusOK},
+		{name: "bad request", status: http.StatusBadRequest},
+		{name: "unauthorized", status: http.StatusUnauthorized},
+		{name: "rate limited", status: http.StatusTooManyRequests, retryable: true},
+		{name: "server error", status: http.StatusBadGateway, retryable: true},
+		{name: "missing API key", status: http.StatusOK, auth: errors.New("no such file")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			api := newMaintenanceAPI(server.URL, time.Second, func(r *http.Request) error {
+				return tt.auth
+			})
+			err := api.do(context.Background(), http.MethodGet, "/maintenance", nil, nil, nil)
+			if tt.status == http.StatusOK && tt.auth == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, tt.retryable, errors.Is(err, ErrRetryable))
+			assert.Equal(t, tt.retryable, errors.Is(err, ErrMaintenance))
+			assert.NotErrorIs(t, err, ErrAlertmanager)
+		})
+	}
+
+	// network errors are retried
+	api := newMaintenanceAPI("http://127.0.0.1:0", time.Second, func(r *http.Request) error {
+		return nil
+	})
+	err := api.do(context.Background(), http.MethodGet, "/maintenance", nil, nil, nil)
+	assert.ErrorIs(t, err, ErrRetryable)
+	assert.ErrorContains(t, err, "maintenance window request failed")
+}
+
+func TestMaintenanceState(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	assert.Equal(t, models.SilenceStatusStatePending, maintenanceState(now, now.Add(time.Minute), now.Add(time.Hour)))
+	assert.Equal(t, models.SilenceStatusStateActive, maintenanceState(now, now, now.Add(time.Hour)))
+	assert.Equal(t, models.SilenceStatusStateExpired, maintenanceState(now, now.Add(-time.Hour), now))
+}
@@ -0,0 +1,88 @@
+package silence
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// ListCreatedSilences returns the active and pending silences created by createdBy
+func ListCreatedSilences(ctx context.Context, silencer Silencer, createdBy string) ([]Silence, error) {
+	existing, err := silencer.ListSilences(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	created := []Silence{}
+	for _, s := range existing {
+		if s.ID == "" || s.CreatedBy != createdBy {
+			continue
+		}
+		if s.State != models.SilenceStatusStateActive && s.State != models.SilenceStatusStatePending {
+			continue
+		}
+		created = append(created, s)
+	}
+	return created, nil
+}
+
+// ListNodeSilences returns the active and pending silences created by config.CreatedBy with the matchers of the
+// silences of the node
+func ListNodeSilences(ctx context.Context, silencer Silencer, config Config, data TemplateData) ([]Silence, error) {
+	keys, err := SilenceKeys(config, data)
+	if err != nil {
+		return nil, err
+	}
+	expected := map[string]bool{}
+	for _, key := range keys {
+		expected[key] = true
+	}
+
+	created, err := ListCreatedSilences(ctx, silencer, config.CreatedBy)
+	if err != nil {
+		return nil, err
+	}
+	silences := []Silence{}
+	for _, s := range created {
+		if expected[silenceKey(s.Matchers)] {
+			silences = append(silences, s)
+		}
+	}
+	return silences, nil
+}
+
+// ExpireNodeSilences expires the silences of the node returned by ListNodeSilences, returning the expired silences
+func ExpireNodeSilences(ctx context.Context, silencer Silencer, config Config, data TemplateData) ([]Change, error) {
+	silences, err := ListNodeSilences(ctx, silencer, config, data)
+	if err != nil {
+		return nil, err
+	}
+
+	expired := []Change{}
+	for _, s := range silences {
+		if err := silencer.ExpireSilence(ctx, s.ID); err != nil {
+			return expired, err
+		}
+		log.Infof("silence %s expired for matchers: %s", s.ID, silenceKey(s.Matchers))
+		expired = append(expired, Change{Action: ChangeExpired, ID: s.ID, Matchers: s.Matchers, StartsAt: s.StartsAt, EndsAt: s.EndsAt})
+	}
+	return expired, nil
+}
+
+// ExpectedSilences returns the silences created by SilenceAlerts for the template data and the node silence window,
+// each with the window of its matcher group
+func ExpectedSilences(config Config, data TemplateData, alertStart time.Time, alertEnd time.Time) ([]Silence, error) {
+	groups, err := config.silences(data)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := []Silence{}
+	for _, group := range groups {
+		startsAt, endsAt := group.window(alertStart, alertEnd)
+		expected = append(expected, Silence{Matchers: group.Matchers, StartsAt: startsAt, EndsAt: endsAt, CreatedBy: config.CreatedBy})
+	}
+	return expected, nil
+}
@@ -0,0 +1,63 @@
+package silence
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go/ptr"
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeSilences(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	silencer := NewFakeSilencer(func() time.Time {
+		return now
+	})
+	ctx := context.Background()
+	config := Config{
+		MatchersJSON:    `[{"name": "instance", "value": "{{.NodeName}}", "isRegex": false}]`,
+		CreatedBy:       DefaultCreatedBy,
+		CommentTemplate: DefaultCommentTemplate,
+	}
+
+	for _, nodeName := range []string{"node1", "node2"} {
+		_, err := SilenceAlerts(ctx, silencer, config, TemplateData{NodeName: nodeName}, now, now, now.Add(30*time.Minute))
+		require.NoError(t, err)
+	}
+	// silences of other creators are ignored
+	_, err := silencer.CreateSilence(ctx, Silence{
+		Matchers:  []*models.Matcher{{Name: ptr.String("instance"), Value: ptr.String("node1"), IsRegex: ptr.Bool(false), IsEqual: ptr.Bool(true)}},
+		StartsAt:  now,
+		EndsAt:    now.Add(time.Hour),
+		CreatedBy: "someone",
+	})
+	require.NoError(t, err)
+
+	created, err := ListCreatedSilences(ctx, silencer, DefaultCreatedBy)
+	require.NoError(t, err)
+	assert.Len(t, created, 2)
+
+	silences, err := ListNodeSilences(ctx, silencer, config, TemplateData{NodeName: "node1"})
+	require.NoError(t, err)
+	require.Len(t, silences, 1)
+	assert.Equal(t, `{instance="node1"}`, silences[0].MatchersString())
+	assert.Equal(t, models.SilenceStatusStateActive, silences[0].State)
+
+	expired, err := ExpireNodeSilences(ctx, silencer, config, TemplateData{NodeName: "node1"})
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	assert.Equal(t, ChangeExpired, expired[0].Action)
+	assert.Equal(t, silences[0].ID, expired[0].ID)
+
+	// expired silences are no longer listed
+	silences, err = ListNodeSilences(ctx, silencer, config, TemplateData{NodeName: "node1"})
+	require.NoError(t, err)
+	assert.Empty(t, silences)
+	created, err = ListCreatedSilences(ctx, silencer, DefaultCreatedBy)
+	require.NoError(t, err)
+	require.Len(t, created, 1)
+	assert.Equal(t, `{instance="node2"}`, created[0].MatchersString())
+}
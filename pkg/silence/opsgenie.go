@@ -0,0 +1,132 @@
+package silence
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+)
+
+// DefaultOpsgenieURL is the Opsgenie REST API used when the target has no URL
+const DefaultOpsgenieURL = "https://api.opsgenie.com"
+
+type opsgenieMaintenanceTime struct {
+	Type      string    `json:"type"`
+	StartDate time.Time `json:"startDate"`
+	EndDate   time.Time `json:"endDate"`
+}
+
+type opsgenieMaintenanceEntity struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+type opsgenieMaintenanceRule struct {
+	State  string                    `json:"state"`
+	Entity opsgenieMaintenanceEntity `json:"entity"`
+}
+
+type opsgenieMaintenance struct {
+	ID          string                    `json:"id,omitempty"`
+	Status      string                    `json:"status,omitempty"`
+	Description string                    `json:"description"`
+	Time        opsgenieMaintenanceTime   `json:"time"`
+	Rules       []opsgenieMaintenanceRule `json:"rules,omitempty"`
+}
+
+type opsgenieMaintenanceResponse struct {
+	Data opsgenieMaintenance `json:"data"`
+}
+
+type opsgenieMaintenanceList struct {
+	Data []opsgenieMaintenance `json:"data"`
+}
+
+// OpsgenieSilencer silences the alerts of Opsgenie integrations with maintenances, for the alerts reaching Opsgenie
+// without going through Alertmanager
+type OpsgenieSilencer struct {
+	api            *maintenanceAPI
+	integrationIDs []string
+}
+
+// NewOpsgenieSilencer creates an OpsgenieSilencer disabling the integrations during the maintenances. The API key
+// file is read on every request so that the key can be rotated
+func NewOpsgenieSilencer(baseURL string, apiKeyFile string, integrationIDs []string, timeout time.Duration) *OpsgenieSilencer {
+	return &OpsgenieSilencer{
+		api: newMaintenanceAPI(baseURL, timeout, func(r *http.Request) error {
+			apiKey, err := readSecretFile(apiKeyFile)
+			if err != nil {
+				return err
+			}
+			r.Header.Set("Authorization", "GenieKey "+apiKey)
+			return nil
+		}),
+		integrationIDs: integrationIDs,
+	}
+}
+
+func (o *OpsgenieSilencer) maintenance(s Silence) opsgenieMaintenance {
+	rules := []opsgenieMaintenanceRule{}
+	for _, id := range o.integrationIDs {
+		rules = append(rules, opsgenieMaintenanceRule{State: "disabled", Entity: opsgenieMaintenanceEntity{ID: id, Type: "integration"}})
+	}
+	return opsgenieMaintenance{
+		Description: maintenanceDescription(s),
+		Time:        opsgenieMaintenanceTime{Type: "schedule", StartDate: s.StartsAt, EndDate: s.EndsAt},
+		Rules:       rules,
+	}
+}
+
+// ListSilences returns the planned and active maintenances, Opsgenie doesn't list their rules so they aren't
+// filtered by integration
+func (o *OpsgenieSilencer) ListSilences(ctx context.Context, matchers []*models.Matcher) ([]Silence, error) {
+	list := opsgenieMaintenanceList{}
+	if err := o.api.do(ctx, http.MethodGet, "/v1/maintenance", url.Values{"type": {"non-expired"}}, nil, &list); err != nil {
+		return nil, err
+	}
+
+	silences := []Silence{}
+	for _, maintenance := range list.Data {
+		s := Silence{
+			ID:       maintenance.ID,
+			StartsAt: maintenance.Time.StartDate,
+			EndsAt:   maintenance.Time.EndDate,
+		}
+		switch maintenance.Status {
+		case "planned":
+			s.State = models.SilenceStatusStatePending
+		case "active":
+			s.State = models.SilenceStatusStateActive
+		default:
+			s.State = models.SilenceStatusStateExpired
+		}
+		parseMaintenanceDescription(&s, maintenance.Description)
+		if hasMatchers(s, matchers) {
+			silences = append(silences, s)
+		}
+	}
+	return silences, nil
+}
+
+func (o *OpsgenieSilencer) CreateSilence(ctx context.Context, s Silence) (string, error) {
+	created := opsgenieMaintenanceResponse{}
+	if err := o.api.do(ctx, http.MethodPost, "/v1/maintenance", nil, o.maintenance(s), &created); err != nil {
+		return "", err
+	}
+	return created.Data.ID, nil
+}
+
+func (o *OpsgenieSilencer) UpdateSilence(ctx context.Context, s Silence) error {
+	if s.ID == "" {
+		return fmt.Errorf("silence to update has no ID")
+	}
+	return o.api.do(ctx, http.MethodPatch, "/v1/maintenance/"+url.PathEscape(s.ID), nil, o.maintenance(s), nil)
+}
+
+// ExpireSilence cancels the maintenance
+func (o *OpsgenieSilencer) ExpireSilence(ctx context.Context, id string) error {
+	return o.api.do(ctx, http.MethodPost, "/v1/maintenance/"+url.PathEscape(id)+"/cancel", nil, nil, nil)
+}
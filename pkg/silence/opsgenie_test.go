@@ -0,0 +1,122 @@
+package silence
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// opsgenieServer is a stand-in of the Opsgenie maintenance API
+type opsgenieServer struct {
+	t *testing.T
+
+	mu           sync.Mutex
+	maintenances []opsgenieMaintenance
+}
+
+func (o *opsgenieServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "GenieKey og_key" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/maintenance":
+		assert.Equal(o.t, "non-expired", r.URL.Query().Get("type"))
+		list := opsgenieMaintenanceList{Data: []opsgenieMaintenance{}}
+		for _, maintenance := range o.maintenances {
+			if maintenance.Status != "cancelled" {
+				// the list doesn't include the rules
+				maintenance.Rules = nil
+				list.Data = append(list.Data, maintenance)
+			}
+		}
+		json.NewEncoder(w).Encode(list)
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/maintenance":
+		maintenance := opsgenieMaintenance{}
+		require.NoError(o.t, json.NewDecoder(r.Body).Decode(&maintenance))
+		assert.Equal(o.t, "schedule", maintenance.Time.Type)
+		assert.Equal(o.t, []opsgenieMaintenanceRule{{State: "disabled", Entity: opsgenieMaintenanceEntity{ID: "integration-1", Type: "integration"}}}, maintenance.Rules)
+		maintenance.ID = fmt.Sprintf("maintenance-%d", len(o.maintenances)+1)
+		maintenance.Status = "active"
+		o.maintenances = append(o.maintenances, maintenance)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(opsgenieMaintenanceResponse{Data: opsgenieMaintenance{ID: maintenance.ID}})
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/cancel"):
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/maintenance/"), "/cancel")
+		for i := range o.maintenances {
+			if o.maintenances[i].ID == id {
+				o.maintenances[i].Status = "cancelled"
+				json.NewEncoder(w).Encode(map[string]string{"result": "Cancelled"})
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestOpsgenieSilencer(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(keyFile, []byte("og_key"), 0o600))
+	server := &opsgenieServer{t: t}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	silencer, err := NewTargetSilencer(Target{
+		Name:           "opsgenie",
+		Type:           TargetTypeOpsgenie,
+		URL:            httpServer.URL,
+		APIKeyFile:     keyFile,
+		IntegrationIDs: []string{"integration-1"},
+	}, time.Second)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	config := Config{
+		MatchersJSON:    `[{"matchers": [{"name": "alertname", "value": "RebootRequired", "isRegex": false}, {"name": "instance", "value": "{{.NodeName}}", "isRegex": false}]}]`,
+		CreatedBy:       DefaultCreatedBy,
+		CommentTemplate: DefaultCommentTemplate,
+	}
+	start := time.Now().Add(-time.Minute).Truncate(time.Second)
+	end := start.Add(time.Hour)
+	for _, nodeName := range []string{"kind-worker", "kind-worker2", "kind-worker"} {
+		_, err := SilenceAlerts(ctx, silencer, config, TemplateData{NodeName: nodeName}, start, start, end)
+		require.NoError(t, err)
+	}
+	require.Len(t, server.maintenances, 2)
+
+	silences, err := silencer.ListSilences(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, silences, 2)
+	assert.Equal(t, "maintenance-1", silences[0].ID)
+	assert.Equal(t, "Silencing during node reboot: kind-worker", silences[0].Comment)
+	assert.Equal(t, models.SilenceStatusStateActive, silences[0].State)
+	assert.True(t, end.Equal(silences[0].EndsAt))
+	assert.Equal(t, `{alertname="RebootRequired", instance="kind-worker"}`, silenceKey(silences[0].Matchers))
+
+	expired, err := ExpireOrphanedSilences(ctx, silencer, DefaultCreatedBy, func(s Silence) bool {
+		return s.Key() == `{alertname="RebootRequired", instance="kind-worker2"}`
+	})
+	require.NoError(t, err)
+	assert.Len(t, expired, 1)
+	assert.Equal(t, "cancelled", server.maintenances[0].Status)
+	assert.Equal(t, "active", server.maintenances[1].Status)
+}
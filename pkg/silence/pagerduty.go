@@ -0,0 +1,131 @@
+package silence
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+)
+
+// DefaultPagerDutyURL is the PagerDuty REST API used when the target has no URL
+const DefaultPagerDutyURL = "https://api.pagerduty.com"
+
+type pagerDutyReference struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+type pagerDutyMaintenanceWindow struct {
+	ID          string               `json:"id,omitempty"`
+	Type        string               `json:"type"`
+	StartTime   time.Time            `json:"start_time"`
+	EndTime     time.Time            `json:"end_time"`
+	Description string               `json:"description"`
+	Services    []pagerDutyReference `json:"services"`
+}
+
+type pagerDutyMaintenanceWindowBody struct {
+	MaintenanceWindow pagerDutyMaintenanceWindow `json:"maintenance_window"`
+}
+
+type pagerDutyMaintenanceWindowList struct {
+	MaintenanceWindows []pagerDutyMaintenanceWindow `json:"maintenance_windows"`
+	More               bool                         `json:"more"`
+}
+
+// PagerDutySilencer silences the alerts of PagerDuty services with maintenance windows, for the alerts reaching
+// PagerDuty without going through Alertmanager
+type PagerDutySilencer struct {
+	api        *maintenanceAPI
+	serviceIDs []string
+	// nowProvider decides the state of the listed maintenance windows
+	nowProvider func() time.Time
+}
+
+// NewPagerDutySilencer creates a PagerDutySilencer putting the services in maintenance. The API key file is read on
+// every request so that the key can be rotated, from is the email of the PagerDuty user creating the windows
+func NewPagerDutySilencer(baseURL string, apiKeyFile string, from string, serviceIDs []string, timeout time.Duration) *PagerDutySilencer {
+	return &PagerDutySilencer{
+		api: newMaintenanceAPI(baseURL, timeout, func(r *http.Request) error {
+			apiKey, err := readSecretFile(apiKeyFile)
+			if err != nil {
+				return err
+			}
+			r.Header.Set("Authorization", "Token token="+apiKey)
+			r.Header.Set("Accept", "application/vnd.pagerduty+json;version=2")
+			r.Header.Set("From", from)
+			return nil
+		}),
+		serviceIDs:  serviceIDs,
+		nowProvider: time.Now,
+	}
+}
+
+func (p *PagerDutySilencer) window(s Silence) pagerDutyMaintenanceWindowBody {
+	services := []pagerDutyReference{}
+	for _, id := range p.serviceIDs {
+		services = append(services, pagerDutyReference{ID: id, Type: "service_reference"})
+	}
+	return pagerDutyMaintenanceWindowBody{MaintenanceWindow: pagerDutyMaintenanceWindow{
+		Type:        "maintenance_window",
+		StartTime:   s.StartsAt,
+		EndTime:     s.EndsAt,
+		Description: maintenanceDescription(s),
+		Services:    services,
+	}}
+}
+
+// ListSilences returns the ongoing and future maintenance windows of the services
+func (p *PagerDutySilencer) ListSilences(ctx context.Context, matchers []*models.Matcher) ([]Silence, error) {
+	silences := []Silence{}
+	now := p.nowProvider()
+	for offset := 0; ; {
+		query := url.Values{"filter": {"open"}, "offset": {strconv.Itoa(offset)}, "limit": {"100"}, "service_ids[]": p.serviceIDs}
+		list := pagerDutyMaintenanceWindowList{}
+		if err := p.api.do(ctx, http.MethodGet, "/maintenance_windows", query, nil, &list); err != nil {
+			return nil, err
+		}
+
+		for _, window := range list.MaintenanceWindows {
+			s := Silence{
+				ID:       window.ID,
+				StartsAt: window.StartTime,
+				EndsAt:   window.EndTime,
+				State:    maintenanceState(now, window.StartTime, window.EndTime),
+			}
+			parseMaintenanceDescription(&s, window.Description)
+			if hasMatchers(s, matchers) {
+				silences = append(silences, s)
+			}
+		}
+
+		if !list.More || len(list.MaintenanceWindows) == 0 {
+			return silences, nil
+		}
+		offset += len(list.MaintenanceWindows)
+	}
+}
+
+func (p *PagerDutySilencer) CreateSilence(ctx context.Context, s Silence) (string, error) {
+	created := pagerDutyMaintenanceWindowBody{}
+	if err := p.api.do(ctx, http.MethodPost, "/maintenance_windows", nil, p.window(s), &created); err != nil {
+		return "", err
+	}
+	return created.MaintenanceWindow.ID, nil
+}
+
+func (p *PagerDutySilencer) UpdateSilence(ctx context.Context, s Silence) error {
+	if s.ID == "" {
+		return fmt.Errorf("silence to update has no ID")
+	}
+	return p.api.do(ctx, http.MethodPut, "/maintenance_windows/"+url.PathEscape(s.ID), nil, p.window(s), nil)
+}
+
+// ExpireSilence deletes a future maintenance window, or ends an ongoing one
+func (p *PagerDutySilencer) ExpireSilence(ctx context.Context, id string) error {
+	return p.api.do(ctx, http.MethodDelete, "/maintenance_windows/"+url.PathEscape(id), nil, nil, nil)
+}
@@ -0,0 +1,145 @@
+package silence
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pagerDutyServer is a stand-in of the PagerDuty maintenance windows API, paginating by one window
+type pagerDutyServer struct {
+	t *testing.T
+
+	mu      sync.Mutex
+	windows []pagerDutyMaintenanceWindow
+}
+
+func (p *pagerDutyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Token token=pd_key" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	assert.Equal(p.t, "oncall@example.com", r.Header.Get("From"))
+	w.Header().Set("Content-Type", "application/json")
+
+	id := strings.TrimPrefix(r.URL.Path, "/maintenance_windows/")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/maintenance_windows":
+		assert.Equal(p.t, []string{"PSERVICE1", "PSERVICE2"}, r.URL.Query()["service_ids[]"])
+		open := []pagerDutyMaintenanceWindow{}
+		for _, window := range p.windows {
+			if window.EndTime.After(time.Now()) {
+				open = append(open, window)
+			}
+		}
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		list := pagerDutyMaintenanceWindowList{MaintenanceWindows: []pagerDutyMaintenanceWindow{}}
+		if offset < len(open) {
+			list.MaintenanceWindows = open[offset : offset+1]
+			list.More = offset+1 < len(open)
+		}
+		json.NewEncoder(w).Encode(list)
+	case r.Method == http.MethodPost && r.URL.Path == "/maintenance_windows":
+		body := pagerDutyMaintenanceWindowBody{}
+		require.NoError(p.t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(p.t, []pagerDutyReference{{ID: "PSERVICE1", Type: "service_reference"}, {ID: "PSERVICE2", Type: "service_reference"}}, body.MaintenanceWindow.Services)
+		body.MaintenanceWindow.ID = fmt.Sprintf("PWINDOW%d", len(p.windows)+1)
+		p.windows = append(p.windows, body.MaintenanceWindow)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(body)
+	case r.Method == http.MethodDelete:
+		for i := range p.windows {
+			if p.windows[i].ID == id {
+				p.windows[i].EndTime = time.Now()
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestPagerDutySilencer(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(keyFile, []byte("pd_key\n"), 0o600))
+	server := &pagerDutyServer{t: t}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	silencer, err := NewTargetSilencer(Target{
+		Name:       "pagerduty",
+		Type:       TargetTypePagerDuty,
+		URL:        httpServer.URL,
+		APIKeyFile: keyFile,
+		From:       "oncall@example.com",
+		ServiceIDs: []string{"PSERVICE1", "PSERVICE2"},
+	}, time.Second)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	config := Config{
+		MatchersJSON:    `[{"name": "instance", "value": "{{.NodeName}}", "isRegex": false}]`,
+		CreatedBy:       DefaultCreatedBy,
+		CommentTemplate: DefaultCommentTemplate,
+	}
+	start := time.Now().Add(-time.Minute).Truncate(time.Second)
+	end := start.Add(time.Hour)
+	for _, nodeName := range []string{"kind-worker", "kind-worker2", "kind-worker"} {
+		_, err := SilenceAlerts(ctx, silencer, config, TemplateData{NodeName: nodeName}, start, start, end)
+		require.NoError(t, err)
+	}
+	require.Len(t, server.windows, 2)
+	assert.Equal(t, "Silencing during node reboot: kind-worker\ncreated by: kured-alert-silencer\nmatchers: {instance=\"kind-worker\"}", server.windows[0].Description)
+
+	silences, err := silencer.ListSilences(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, silences, 2)
+	assert.Equal(t, "PWINDOW2", silences[1].ID)
+	assert.Equal(t, "Silencing during node reboot: kind-worker2", silences[1].Comment)
+	assert.Equal(t, DefaultCreatedBy, silences[1].CreatedBy)
+	assert.Equal(t, models.SilenceStatusStateActive, silences[1].State)
+	assert.Equal(t, `{instance="kind-worker2"}`, silenceKey(silences[1].Matchers))
+
+	// the state of the windows follows the clock of the silencer
+	silencer.(*PagerDutySilencer).nowProvider = func() time.Time {
+		return start.Add(-time.Minute)
+	}
+	silences, err = silencer.ListSilences(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, models.SilenceStatusStatePending, silences[1].State)
+	silencer.(*PagerDutySilencer).nowProvider = time.Now
+
+	expired, err := ExpireOrphanedSilences(ctx, silencer, DefaultCreatedBy, func(s Silence) bool {
+		return s.Key() == `{instance="kind-worker"}`
+	})
+	require.NoError(t, err)
+	assert.Len(t, expired, 1)
+	silences, err = silencer.ListSilences(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, silences, 1)
+	assert.Equal(t, "PWINDOW1", silences[0].ID)
+
+	// invalid credentials aren't retried
+	require.NoError(t, os.WriteFile(keyFile, []byte("revoked"), 0o600))
+	_, err = silencer.ListSilences(ctx, nil)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrRetryable)
+}
@@ -2,56 +2,511 @@ package silence
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
 	"text/template"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
-	"github.com/aws/smithy-go/ptr"
+	"github.com/go-openapi/runtime"
+	httptransport "github.com/go-openapi/runtime/client"
 	"github.com/go-openapi/strfmt"
 	"github.com/prometheus/alertmanager/api/v2/client"
 	"github.com/prometheus/alertmanager/api/v2/client/silence"
 	"github.com/prometheus/alertmanager/api/v2/models"
 )
 
-// generate models.Matcher form JSON string with format `[{"name": "instance", "value": "{{.NodeName}}"}, {"name": "alertname", "value": "node_reboot"}]`
-func generateMatchers(matchersJSON string, nodeName string) ([]*models.Matcher, error) {
-	tmpl, err := template.New("matchers").Parse(matchersJSON)
+const (
+	// DefaultCreatedBy is the createdBy value used when none is configured
+	DefaultCreatedBy = "kured-alert-silencer"
+	// DefaultManualCreatedBy is the createdBy value of the silences of the silence command, apart from the silencer
+	// ones so that its cleanup does not expire them
+	DefaultManualCreatedBy = "kured-alert-silencer-manual"
+	// DefaultCommentTemplate is the comment template used when none is configured
+	DefaultCommentTemplate = "Silencing during node reboot: {{.NodeName}}"
+	// DefaultRequestTimeout bounds each Alertmanager API request when no timeout is configured
+	DefaultRequestTimeout = 10 * time.Second
+)
+
+// AlertmanagerClient is the Alertmanager v2 silence API, an interface so that callers can inject fakes
+type AlertmanagerClient = silence.ClientService
+
+// ErrRetryable marks the failures of the silence targets worth retrying, e.g. network errors, rate limits and server
+// errors, whatever the target
+var ErrRetryable = errors.New("retryable target failure")
+
+// retryableError marks an error with ErrRetryable without changing its message
+type retryableError struct {
+	error
+}
+
+func (e retryableError) Is(target error) bool {
+	return target == ErrRetryable
+}
+
+func (e retryableError) Unwrap() error {
+	return e.error
+}
+
+// ErrAlertmanager wraps the errors of the Alertmanager API requests, which are marked with ErrRetryable
+var ErrAlertmanager = errors.New("alertmanager request failed")
+
+// ErrMaintenance wraps the retryable errors of the maintenance window API requests of PagerDuty and Opsgenie
+var ErrMaintenance = errors.New("maintenance window request failed")
+
+// alertmanagerError wraps an Alertmanager API error with ErrAlertmanager and marks it with ErrRetryable
+func alertmanagerError(err error) error {
+	return retryableError{fmt.Errorf("%w: %w", ErrAlertmanager, err)}
+}
+
+// ErrBroadMatchers is returned, and not retried, when a rendered silence could silence the alerts of other nodes
+var ErrBroadMatchers = errors.New("silence matchers are too broad")
+
+// Config holds the settings applied to every silence created by the silencer
+type Config struct {
+	MatchersJSON    string
+	CreatedBy       string
+	CommentTemplate string
+	// CanaryValues are label values of unrelated alerts that no regex matcher may match
+	CanaryValues []string
+	// Exclusions are negative matchers appended to every silence, see ParseExclusions
+	Exclusions []*models.Matcher
+	// SingleWindow creates a single silence with the matchers of the first group for the whole node window, for the
+	// maintenance window targets muting whole services whatever the matchers
+	SingleWindow bool
+}
+
+// TemplateData holds the values available to the matchers and comment templates
+type TemplateData struct {
+	NodeName      string
+	ClusterName   string
+	SilencerPod   string
+	LockCreated   time.Time
+	LockMetadata  map[string]interface{}
+	Unschedulable bool
+	// Namespace, Pod, WorkloadKind, WorkloadName, WorkloadLabel and PodNameSuffix are only set for the silences of the
+	// pods running on the node
+	Namespace    string
+	Pod          string
+	WorkloadKind string
+	WorkloadName string
+	// WorkloadLabel is the kube-state-metrics label naming the workload, e.g. job_name for a Job
+	WorkloadLabel string
+	// PodNameSuffix is the regex of what follows the workload name in the names of its pods, e.g. -[0-9]+ for a
+	// StatefulSet
+	PodNameSuffix string
+	// NodeLabels is only set when rendering the tenant of a target
+	NodeLabels map[string]string
+}
+
+// templateFuncs are the functions available to the matchers, comment and tenant templates
+var templateFuncs = template.FuncMap{
+	// quoteRegex escapes the regex metacharacters of a value for a regex matcher of the matchers JSON, e.g.
+	// `{{quoteRegex .WorkloadName}}{{.PodNameSuffix}}`, the backslashes being escaped for the JSON string
+	"quoteRegex": func(value string) string {
+		return strings.ReplaceAll(regexp.QuoteMeta(value), `\`, `\\`)
+	},
+}
+
+// newTemplate creates a template with the templateFuncs
+func newTemplate(name string) *template.Template {
+	return template.New(name).Funcs(templateFuncs)
+}
+
+// render a Go template with the given data
+func renderTemplate(name string, text string, data TemplateData) (bytes.Buffer, error) {
+	var tpl bytes.Buffer
+
+	tmpl, err := newTemplate(name).Parse(text)
 	if err != nil {
-		return nil, err
+		return tpl, err
 	}
 
-	data := map[string]string{
-		"NodeName": nodeName,
+	if err := tmpl.Execute(&tpl, data); err != nil {
+		return tpl, err
 	}
+	return tpl, nil
+}
 
-	var tpl bytes.Buffer
-	if err := tmpl.Execute(&tpl, data); err != nil {
+// groupDuration is a duration of the matcher groups JSON in Go duration format, e.g. "30m"
+type groupDuration time.Duration
+
+func (d *groupDuration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = groupDuration(duration)
+	return nil
+}
+
+// matcherGroup is a set of matchers silenced together in a single silence
+type matcherGroup struct {
+	Matchers []*models.Matcher `json:"matchers"`
+	// Duration replaces the length of the node silence window, measured from its start, when set. The group silence
+	// then ignores the end of the node window, including its extension by the release lag
+	Duration groupDuration `json:"duration"`
+	// Delay shifts the node silence window later, for alerts only firing once the node is back
+	Delay groupDuration `json:"delay"`
+}
+
+// custom reports whether the group has its own silence window
+func (g matcherGroup) custom() bool {
+	return g.Duration > 0 || g.Delay > 0
+}
+
+// window returns the silence window of the group derived from the node silence window
+func (g matcherGroup) window(start time.Time, end time.Time) (time.Time, time.Time) {
+	start = start.Add(time.Duration(g.Delay))
+	end = end.Add(time.Duration(g.Delay))
+	if g.Duration > 0 {
+		end = start.Add(time.Duration(g.Duration))
+	}
+	return start, end
+}
+
+// generate the matchers of each silence from JSON string, see generateGroups
+func generateMatchers(matchersJSON string, data TemplateData) ([][]*models.Matcher, error) {
+	groups, err := generateGroups(matchersJSON, data)
+	if err != nil {
 		return nil, err
 	}
 
-	var matchers []*models.Matcher
+	silences := [][]*models.Matcher{}
+	for _, group := range groups {
+		silences = append(silences, group.Matchers)
+	}
+	return silences, nil
+}
+
+// generate the matcher groups of each silence from JSON string, either a list of matchers silenced one by one with format
+// `[{"name": "instance", "value": "{{.NodeName}}"}, {"name": "alertname", "value": "node_reboot"}]`
+// or a list of matcher groups silenced together with format `[{"matchers": [{"name": "instance", "value": "{{.NodeName}}"}, ...]}]`,
+// where each group may carry its own "duration" and "delay". Groups exist for the pending reboot silences, which must
+// match both the RebootRequired alert and the node: silenced one by one, the alertname matcher would silence the
+// pending reboot of every node and the instance matcher every alert of a node that is not rebooting yet
+func generateGroups(matchersJSON string, data TemplateData) ([]matcherGroup, error) {
+	tpl, err := renderTemplate("matchers", matchersJSON, data)
+	if err != nil {
+		return nil, err
+	}
 	log.Debugf("rendered matchers: %s", tpl.String())
-	err = json.Unmarshal(tpl.Bytes(), &matchers)
+
+	var elements []map[string]json.RawMessage
+	err = json.Unmarshal(tpl.Bytes(), &elements)
 	if err != nil {
 		return nil, err
 	}
 
+	var silences []matcherGroup
+	for _, element := range elements {
+		if _, ok := element["matchers"]; ok {
+			var groups []matcherGroup
+			if err := json.Unmarshal(tpl.Bytes(), &groups); err != nil {
+				return nil, err
+			}
+			for _, group := range groups {
+				if len(group.Matchers) == 0 {
+					return nil, fmt.Errorf("matcher group has no matchers")
+				}
+				if group.Duration < 0 || group.Delay < 0 {
+					return nil, fmt.Errorf("matcher group %s has a negative duration or delay", matchersString(group.Matchers))
+				}
+				silences = append(silences, group)
+			}
+			break
+		}
+	}
+
+	if silences == nil {
+		var matchers []*models.Matcher
+		if err := json.Unmarshal(tpl.Bytes(), &matchers); err != nil {
+			return nil, err
+		}
+		for _, matcher := range matchers {
+			silences = append(silences, matcherGroup{Matchers: []*models.Matcher{matcher}})
+		}
+	}
+
 	// check that matchers contain required fields
+	for _, group := range silences {
+		for _, matcher := range group.Matchers {
+			if matcher == nil || matcher.Name == nil || matcher.Value == nil || matcher.IsRegex == nil {
+				return nil, fmt.Errorf("matcher is missing required fields")
+			}
+		}
+		if err := validateMatchers(group.Matchers); err != nil {
+			return nil, err
+		}
+	}
+
+	return silences, nil
+}
+
+// silences returns the matcher groups of each silence of the configuration, exclusions included
+func (c Config) silences(data TemplateData) ([]matcherGroup, error) {
+	groups, err := generateGroups(c.MatchersJSON, data)
+	if err != nil {
+		return nil, err
+	}
+	if c.SingleWindow && len(groups) > 0 {
+		groups = []matcherGroup{{Matchers: groups[0].Matchers}}
+	}
+	for i := range groups {
+		groups[i].Matchers = MergeExclusions(groups[i].Matchers, c.Exclusions)
+	}
+	return groups, nil
+}
+
+// catchAllSample is a label value that only a catch-all regex matcher matches
+const catchAllSample = "kured-alert-silencer catch-all check"
+
+// matches reports whether the matcher matches the label value, an empty value being a missing label
+func matches(matcher *models.Matcher, value string) (bool, error) {
+	equal := matcher.IsEqual == nil || *matcher.IsEqual
+	matched := *matcher.Value == value
+	if *matcher.IsRegex {
+		re, err := regexp.Compile("^(?:" + *matcher.Value + ")$")
+		if err != nil {
+			return false, fmt.Errorf("matcher %s has an invalid regex: %w", matcherString(matcher), err)
+		}
+		matched = re.MatchString(value)
+	}
+	return matched == equal, nil
+}
+
+// validateMatchers rejects the silences that would silence far more alerts than intended, usually because a template
+// rendered an empty value: empty names or values, regexes matching any value like `.*`, and silences whose every
+// matcher matches a missing label, which Alertmanager also rejects
+func validateMatchers(matchers []*models.Matcher) error {
+	matchesMissing := 0
+	for _, matcher := range matchers {
+		if *matcher.Name == "" {
+			return fmt.Errorf("matcher %s has an empty name", matcherString(matcher))
+		}
+		if *matcher.Value == "" && (matcher.IsEqual == nil || *matcher.IsEqual) {
+			return fmt.Errorf("%w: matcher %s has an empty value", ErrBroadMatchers, matcherString(matcher))
+		}
+
+		matchesEmpty, err := matches(matcher, "")
+		if err != nil {
+			return err
+		}
+		matchesAny, err := matches(matcher, catchAllSample)
+		if err != nil {
+			return err
+		}
+		if (matcher.IsEqual == nil || *matcher.IsEqual) && matchesAny {
+			return fmt.Errorf("%w: matcher %s matches any value", ErrBroadMatchers, matcherString(matcher))
+		}
+		if matchesEmpty {
+			matchesMissing++
+		}
+	}
+	if matchesMissing == len(matchers) {
+		return fmt.Errorf("%w: silence %s matches every alert without its labels", ErrBroadMatchers, matchersString(matchers))
+	}
+	return nil
+}
+
+// specificValues returns the values identifying the node, or the pod or workload, the silences are created for
+func specificValues(data TemplateData) []string {
+	values := []string{}
+	for _, value := range []string{data.NodeName, data.Pod, data.WorkloadName} {
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// identifies reports whether a positive matcher is on the value: an equal matcher with the value itself, or a regex
+// matcher matching the value or anchored on it, the quoted value starting the regex followed by a character that
+// can't continue a name, e.g. node1:.* or web-.* for a pod of the workload web but not node10 or web2-.*
+func identifies(matcher *models.Matcher, value string) (bool, error) {
+	if !*matcher.IsRegex {
+		return *matcher.Value == value, nil
+	}
+	matched, err := matches(matcher, value)
+	if err != nil || matched {
+		return matched, err
+	}
+	anchored := regexp.MustCompile(fmt.Sprintf(`^%s-?[^%s]`, regexp.QuoteMeta(regexp.QuoteMeta(value)), nameCharacters))
+	return anchored.MatchString(*matcher.Value), nil
+}
+
+// checkSpecific refuses a silence without a positive matcher on the node, pod or workload, e.g. when the node name
+// rendered empty, or with a regex matcher matching one of the canary values
+func checkSpecific(matchers []*models.Matcher, data TemplateData, canaryValues []string) error {
+	specific := false
 	for _, matcher := range matchers {
-		if matcher.Name == nil || matcher.Value == nil || matcher.IsRegex == nil {
-			return nil, fmt.Errorf("matcher is missing required fields")
+		if matcher.IsEqual != nil && !*matcher.IsEqual {
+			continue
+		}
+		for _, value := range specificValues(data) {
+			identified, err := identifies(matcher, value)
+			if err != nil {
+				return err
+			}
+			if identified {
+				specific = true
+			}
+		}
+		if !*matcher.IsRegex {
+			continue
+		}
+		for _, canaryValue := range canaryValues {
+			matched, err := matches(matcher, canaryValue)
+			if err != nil {
+				return err
+			}
+			if matched {
+				return fmt.Errorf("%w: matcher %s matches canary value %q", ErrBroadMatchers, matcherString(matcher), canaryValue)
+			}
+		}
+	}
+	if !specific {
+		return fmt.Errorf("%w: silence %s has no matcher on node %q", ErrBroadMatchers, matchersString(matchers), data.NodeName)
+	}
+	return nil
+}
+
+// sampleTemplateData fills every field of the template data to validate the templates at startup
+func sampleTemplateData(data TemplateData) TemplateData {
+	if data.ClusterName == "" {
+		data.ClusterName = "cluster"
+	}
+	data.NodeName = "sample-node"
+	data.LockCreated = time.Now()
+	data.Namespace = "sample-namespace"
+	data.Pod = "sample-pod"
+	data.WorkloadKind = "statefulset"
+	data.WorkloadName = "sample-workload"
+	data.WorkloadLabel = "statefulset"
+	data.PodNameSuffix = "-[0-9]+"
+	data.NodeLabels = map[string]string{}
+	return data
+}
+
+// Validate checks the templates of the configuration by rendering them for a sample node, and the durations of the
+// matcher groups against the bounds
+func (c Config) Validate(data TemplateData, minDuration time.Duration, maxDuration time.Duration) error {
+	data = sampleTemplateData(data)
+	errs := []error{}
+	silences, err := c.silences(data)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("matchers: %w", err))
+	}
+	for _, group := range silences {
+		if err := checkSpecific(group.Matchers, data, c.CanaryValues); err != nil {
+			errs = append(errs, fmt.Errorf("matchers: %w", err))
+		}
+		if !group.custom() {
+			continue
+		}
+		// the longest window of the group, of its whole duration, starts after its delay
+		duration := time.Duration(group.Duration)
+		if group.Duration > 0 && (duration < minDuration || duration > maxDuration) {
+			errs = append(errs, fmt.Errorf("matchers: group %s duration %s is not between %s and %s", matchersString(group.Matchers), duration, minDuration, maxDuration))
 		}
+		if window := time.Duration(group.Delay + group.Duration); window > maxDuration {
+			errs = append(errs, fmt.Errorf("matchers: group %s delay and duration add up to %s, above the maximum %s", matchersString(group.Matchers), window, maxDuration))
+		}
+	}
+	if _, err := generateComment(c.CommentTemplate, data); err != nil {
+		errs = append(errs, fmt.Errorf("comment: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// CommentReferencesNode reports whether the comment of the silences mentions the node they are created for, see
+// Silence.References
+func (c Config) CommentReferencesNode(data TemplateData) (bool, error) {
+	data = sampleTemplateData(data)
+	comment, err := generateComment(c.CommentTemplate, data)
+	if err != nil {
+		return false, err
+	}
+	return Silence{Comment: comment}.References(data.NodeName), nil
+}
+
+// format a matcher as an Alertmanager filter, e.g. `instance="node1"` or `alertname=~"node_.*"`
+func matcherString(matcher *models.Matcher) string {
+	operator := "="
+	if matcher.IsEqual != nil && !*matcher.IsEqual {
+		operator = "!"
 	}
+	if matcher.IsRegex != nil && *matcher.IsRegex {
+		operator += "~"
+	} else if operator == "!" {
+		operator += "="
+	}
+	return fmt.Sprintf("%s%s%q", *matcher.Name, operator, *matcher.Value)
+}
 
-	return matchers, nil
+// format matchers the way Alertmanager displays them, e.g. `{instance="node1", alertname="node_reboot"}`
+func matchersString(matchers []*models.Matcher) string {
+	matchersStr := []string{}
+	for _, matcher := range matchers {
+		matchersStr = append(matchersStr, matcherString(matcher))
+	}
+	return "{" + strings.Join(matchersStr, ", ") + "}"
 }
 
-// create client.AlertmanagerAPI from alertmanagerURL
-func NewAlertmanagerClient(alertmanagerURL string) (*client.AlertmanagerAPI, error) {
+// silenceKey identifies a silence by its matchers, regardless of their order
+func silenceKey(matchers []*models.Matcher) string {
+	matchersStr := []string{}
+	for _, matcher := range matchers {
+		matchersStr = append(matchersStr, matcherString(matcher))
+	}
+	sort.Strings(matchersStr)
+	return "{" + strings.Join(matchersStr, ", ") + "}"
+}
+
+// SilenceKeys returns the keys of the silences created by SilenceAlerts for the given template data
+func SilenceKeys(config Config, data TemplateData) ([]string, error) {
+	silences, err := config.silences(data)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for _, group := range silences {
+		keys = append(keys, silenceKey(group.Matchers))
+	}
+	return keys, nil
+}
+
+// generate the silence comment from the comment template
+func generateComment(commentTemplate string, data TemplateData) (string, error) {
+	tpl, err := renderTemplate("comment", commentTemplate, data)
+	if err != nil {
+		return "", err
+	}
+	return tpl.String(), nil
+}
+
+// create the Alertmanager silence API client from alertmanagerURL, each request is bounded by the timeout
+// of the HTTP client as the request params carry no timeout of their own
+func NewAlertmanagerClient(alertmanagerURL string, timeout time.Duration) (AlertmanagerClient, error) {
+	return newAlertmanagerClient(alertmanagerURL, client.DefaultBasePath, timeout, nil)
+}
+
+// create an Alertmanager compatible silence API client serving the API under the basePath of alertmanagerURL
+func newAlertmanagerClient(alertmanagerURL string, basePath string, timeout time.Duration, auth runtime.ClientAuthInfoWriter) (AlertmanagerClient, error) {
 	u, err := url.Parse(alertmanagerURL)
 	if err != nil {
 		return nil, err
@@ -59,99 +514,179 @@ func NewAlertmanagerClient(alertmanagerURL string) (*client.AlertmanagerAPI, err
 
 	scheme := u.Scheme
 	host := u.Host
+	basePath = path.Join("/", u.Path, basePath)
 
 	log.Debugf("Alertmanager scheme: %s", scheme)
 	log.Debugf("Alertmanager host: %s", host)
-	config := client.DefaultTransportConfig().WithSchemes([]string{scheme}).WithHost(host)
+	log.Debugf("Alertmanager base path: %s", basePath)
+	log.Debugf("Alertmanager request timeout: %s", timeout)
+	transport := httptransport.NewWithClient(host, basePath, []string{scheme}, &http.Client{Timeout: timeout})
+	transport.DefaultAuthentication = auth
 
-	alertmanager := client.NewHTTPClientWithConfig(nil, config)
-	return alertmanager, nil
+	alertmanager := client.New(transport, strfmt.Default)
+	return alertmanager.Silence, nil
 }
 
-// Get silences from Alertmanager that match the given matcher until the alertEnd time
-func silenceExistsUntil(alertmanager *client.AlertmanagerAPI, matcher *models.Matcher, alertEnd time.Time) (bool, error) {
-	getSilencesParams := silence.NewGetSilencesParams()
-	matchersStr := []string{fmt.Sprintf("%s=%s", *matcher.Name, *matcher.Value)}
+// Get silences with exactly the given matchers until the alertEnd time
+func silenceExistsUntil(ctx context.Context, silencer Silencer, matchers []*models.Matcher, alertEnd time.Time) (bool, error) {
+	exists, _, err := findSilence(ctx, silencer, matchers, alertEnd)
+	return exists, err
+}
 
-	getSilencesResp, err := alertmanager.Silence.GetSilences(getSilencesParams.WithFilter(matchersStr))
+// findSilence reports whether a silence with exactly the given matchers lasts until the alertEnd time, and otherwise
+// whether such a silence ends before and needs to be extended. A silence with additional matchers is narrower than
+// the requested one and does not cover it, which only happens with matcher groups as a single matcher silence has no
+// other matcher
+func findSilence(ctx context.Context, silencer Silencer, matchers []*models.Matcher, alertEnd time.Time) (bool, bool, error) {
+	existing, err := silencer.ListSilences(ctx, matchers)
 	if err != nil {
-		return true, err
-	}
-
-	if len(getSilencesResp.Payload) > 0 {
-		expectedTime := alertEnd.Truncate(time.Millisecond)
-		log.Tracef("expected silence ends at: %s", strfmt.DateTime(expectedTime))
-		// check if ALL existing silences are going to be still active
-		for _, tableSilence := range getSilencesResp.Payload {
-			log.Tracef("existing silence ends at: %s", tableSilence.Silence.EndsAt)
-			existingTime := time.Time(*tableSilence.Silence.EndsAt)
-			if expectedTime == existingTime || expectedTime.Before(existingTime) {
-				return true, nil
-			}
-		}
-		// all existing silences are going to be expired
-		return false, nil
+		return true, false, err
+	}
 
-	} else {
-		return false, nil
+	expectedTime := alertEnd.Truncate(time.Millisecond)
+	log.Tracef("expected silence ends at: %s", strfmt.DateTime(expectedTime))
+	shorter := false
+	// check if ALL existing silences are going to be still active
+	for _, tableSilence := range existing {
+		// the filter also returns silences with additional matchers
+		if len(tableSilence.Matchers) != len(matchers) {
+			continue
+		}
+		log.Tracef("existing silence ends at: %s", strfmt.DateTime(tableSilence.EndsAt))
+		existingTime := tableSilence.EndsAt
+		if expectedTime.Equal(existingTime) || expectedTime.Before(existingTime) {
+			return true, false, nil
+		}
+		if tableSilence.State != models.SilenceStatusStateExpired {
+			shorter = true
+		}
 	}
+	// all existing silences are going to be expired
+	return false, shorter, nil
 }
 
-// SilenceAlerts silences alerts in Alertmanager
-func SilenceAlerts(alertmanager *client.AlertmanagerAPI, matchersJSON string, nodeName string, alertEnd time.Time) error {
-	startsAt := (*strfmt.DateTime)(ptr.Time(time.Now()))
-	endsAt := (*strfmt.DateTime)(ptr.Time(alertEnd))
+const (
+	// ChangeCreated is a silence created for matchers without silence
+	ChangeCreated = "created"
+	// ChangeExtended is a silence created for matchers whose silence ends too early
+	ChangeExtended = "extended"
+	// ChangeExpired is an orphaned silence expired by the cleanup
+	ChangeExpired = "expired"
+)
 
-	matchers, err := generateMatchers(matchersJSON, nodeName)
+// Change is a silence created or expired by the silencer
+type Change struct {
+	// Action is one of the Change values
+	Action   string
+	ID       string
+	Matchers []*models.Matcher
+	StartsAt time.Time
+	EndsAt   time.Time
+}
+
+// MatchersString formats the matchers of the change the way Alertmanager displays them
+func (c Change) MatchersString() string {
+	return matchersString(c.Matchers)
+}
+
+// SilenceAlerts silences alerts with the silencer and returns the created silences, including the ones created
+// before failing. now skips the matcher groups whose window is already over
+func SilenceAlerts(ctx context.Context, silencer Silencer, config Config, data TemplateData, now time.Time, alertStart time.Time, alertEnd time.Time) ([]Change, error) {
+	silences, err := config.silences(data)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	// refuse every silence of the node when one is too broad
+	for _, group := range silences {
+		if err := checkSpecific(group.Matchers, data, config.CanaryValues); err != nil {
+			return nil, err
+		}
 	}
-	log.Infof("silencing %v alerts with matchers", len(matchers))
 
-	for _, matcher := range matchers {
-		log.Debugf(
-			"matcher: %sIsRegex: %t, Name: %s, Value: %s",
-			func(b *bool) interface{} {
-				if b == nil {
-					return ""
-				} else {
-					return fmt.Sprintf("IsEqual: %t, ", *b)
-				}
-			}(matcher.IsEqual),
-			*matcher.IsRegex,
-			*matcher.Name,
-			*matcher.Value,
-		)
+	comment, err := generateComment(config.CommentTemplate, data)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("silencing alerts with %v silences", len(silences))
+
+	changes := []Change{}
+	for _, group := range silences {
+		matchers := group.Matchers
+		startsAt, endsAt := group.window(alertStart, alertEnd)
+		// a group window shorter than the node one may be over already, e.g. when the silence is extended on release
+		if group.custom() && !endsAt.After(now) {
+			log.Debugf("silence window already over for matchers: %s", matchersString(matchers))
+			continue
+		}
 
-		exists, err := silenceExistsUntil(alertmanager, matcher, alertEnd)
+		for _, matcher := range matchers {
+			log.Debugf(
+				"matcher: %sIsRegex: %t, Name: %s, Value: %s",
+				func(b *bool) interface{} {
+					if b == nil {
+						return ""
+					} else {
+						return fmt.Sprintf("IsEqual: %t, ", *b)
+					}
+				}(matcher.IsEqual),
+				*matcher.IsRegex,
+				*matcher.Name,
+				*matcher.Value,
+			)
+		}
+
+		exists, shorter, err := findSilence(ctx, silencer, matchers, endsAt)
 		if err != nil {
-			return err
+			return changes, err
 		}
 
 		if exists {
-			log.Debugf("silence already exists for matcher: %s=%s", *matcher.Name, *matcher.Value)
+			log.Debugf("silence already exists for matchers: %s", matchersString(matchers))
 			continue
 		}
 
-		postSilenceParams := silence.NewPostSilencesParams().WithSilence(
-			&models.PostableSilence{
-				Silence: models.Silence{
-					Matchers:  []*models.Matcher{matcher},
-					StartsAt:  startsAt,
-					EndsAt:    endsAt,
-					CreatedBy: ptr.String("kured-alert-silencer"),
-					Comment:   ptr.String("Silencing during node reboot: " + nodeName),
-				},
-			},
-		)
-
-		_, err = alertmanager.Silence.PostSilences(postSilenceParams)
+		id, err := silencer.CreateSilence(ctx, Silence{
+			Matchers:  matchers,
+			StartsAt:  startsAt,
+			EndsAt:    endsAt,
+			CreatedBy: config.CreatedBy,
+			Comment:   comment,
+		})
 		if err != nil {
-			return err
+			return changes, err
 		}
 
-		log.Debugf("silence created for matcher: %s=%s", *matcher.Name, *matcher.Value)
+		log.Debugf("silence created for matchers: %s", matchersString(matchers))
 		log.Info("silence created successfully")
+		action := ChangeCreated
+		if shorter {
+			action = ChangeExtended
+		}
+		changes = append(changes, Change{Action: action, ID: id, Matchers: matchers, StartsAt: startsAt, EndsAt: endsAt})
 	}
-	return nil
+	return changes, nil
+}
+
+// ExpireOrphanedSilences expires the active and pending silences created by createdBy that are not kept, returning
+// the expired silences
+func ExpireOrphanedSilences(ctx context.Context, silencer Silencer, createdBy string, keep func(s Silence) bool) ([]Change, error) {
+	created, err := ListCreatedSilences(ctx, silencer, createdBy)
+	if err != nil {
+		return nil, err
+	}
+
+	expired := []Change{}
+	for _, s := range created {
+		key := silenceKey(s.Matchers)
+		if keep(s) {
+			continue
+		}
+
+		if err := silencer.ExpireSilence(ctx, s.ID); err != nil {
+			return expired, err
+		}
+		log.Infof("orphaned silence %s expired for matchers: %s", s.ID, key)
+		expired = append(expired, Change{Action: ChangeExpired, ID: s.ID, Matchers: s.Matchers, StartsAt: s.StartsAt, EndsAt: s.EndsAt})
+	}
+	return expired, nil
 }
@@ -1,16 +1,21 @@
 package silence
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/aws/smithy-go/ptr"
 	"github.com/go-openapi/strfmt"
+	"github.com/prometheus/alertmanager/api/v2/client/silence"
 	"github.com/prometheus/alertmanager/api/v2/models"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // Mock server for Alertmanager API
@@ -46,15 +51,150 @@ func TestGenerateMatchers(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			matchers, err := generateMatchers(tt.jsonInput, tt.nodeName)
+			matchers, err := generateMatchers(tt.jsonInput, TemplateData{NodeName: tt.nodeName})
 			if tt.expectErr {
 				assert.Error(t, err)
 			} else {
 				assert.NoError(t, err)
-				assert.Equal(t, "instance", *matchers[0].Name)
-				assert.Equal(t, "node1", *matchers[0].Value)
-				assert.Equal(t, "alertname", *matchers[1].Name)
-				assert.Equal(t, "node_reboot", *matchers[1].Value)
+				assert.Equal(t, "instance", *matchers[0][0].Name)
+				assert.Equal(t, "node1", *matchers[0][0].Value)
+				assert.Equal(t, "alertname", *matchers[1][0].Name)
+				assert.Equal(t, "node_reboot", *matchers[1][0].Value)
+			}
+		})
+	}
+}
+
+func TestGenerateMatcherGroups(t *testing.T) {
+	groupsJSON := `[{"matchers": [{"name": "instance", "value": "{{.NodeName}}", "isRegex": false}, {"name": "alertname", "value": "RebootRequired", "isRegex": false}]}, {"matchers": [{"name": "node", "value": "{{.NodeName}}", "isRegex": false}]}]`
+	emptyGroupJSON := `[{"matchers": []}]`
+	missingFieldsGroupJSON := `[{"matchers": [{"name": "instance", "value": "{{.NodeName}}"}]}]`
+
+	matchers, err := generateMatchers(groupsJSON, TemplateData{NodeName: "node1"})
+	assert.NoError(t, err)
+	assert.Len(t, matchers, 2)
+	assert.Equal(t, `{instance="node1", alertname="RebootRequired"}`, matchersString(matchers[0]))
+	assert.Equal(t, `{node="node1"}`, matchersString(matchers[1]))
+
+	_, err = generateMatchers(emptyGroupJSON, TemplateData{NodeName: "node1"})
+	assert.Error(t, err)
+
+	_, err = generateMatchers(missingFieldsGroupJSON, TemplateData{NodeName: "node1"})
+	assert.Error(t, err)
+}
+
+func TestQuoteRegex(t *testing.T) {
+	matchersJSON := `[{"matchers": [{"name": "namespace", "value": "{{.Namespace}}", "isRegex": false}, {"name": "pod", "value": "{{quoteRegex .WorkloadName}}-.*", "isRegex": true}]}]`
+	data := TemplateData{NodeName: "node1", Namespace: "default", WorkloadName: "web.v2"}
+
+	matchers, err := generateMatchers(matchersJSON, data)
+	require.NoError(t, err)
+	require.Len(t, matchers, 1)
+	assert.Equal(t, `web\.v2-.*`, *matchers[0][1].Value)
+	matched, err := matches(matchers[0][1], "web.v2-6d4cf56db6-abcde")
+	require.NoError(t, err)
+	assert.True(t, matched)
+	matched, err = matches(matchers[0][1], "webxv2-6d4cf56db6-abcde")
+	require.NoError(t, err)
+	assert.False(t, matched)
+
+	// the escaped workload name still identifies the workload
+	assert.NoError(t, checkSpecific(matchers[0], data, nil))
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		matchersJSON string
+		comment      string
+		expectErr    bool
+	}{
+		{"Node matchers", `[{"name": "instance", "value": "{{.NodeName}}", "isRegex": false}]`, DefaultCommentTemplate, false},
+		{"Negative matcher with a positive one", `[{"matchers": [{"name": "instance", "value": "{{.NodeName}}", "isRegex": false}, {"name": "severity", "value": "", "isRegex": false, "isEqual": false}]}]`, DefaultCommentTemplate, false},
+		{"Empty value", `[{"name": "instance", "value": "", "isRegex": false}]`, DefaultCommentTemplate, true},
+		{"Empty name", `[{"name": "", "value": "{{.NodeName}}", "isRegex": false}]`, DefaultCommentTemplate, true},
+		{"Match anything regex", `[{"name": "instance", "value": ".*", "isRegex": true}]`, DefaultCommentTemplate, true},
+		{"Match any value regex", `[{"name": "instance", "value": ".+", "isRegex": true}]`, DefaultCommentTemplate, true},
+		{"Negative matchers only", `[{"name": "instance", "value": "{{.NodeName}}", "isRegex": false, "isEqual": false}]`, DefaultCommentTemplate, true},
+		{"No node matcher", `[{"name": "alertname", "value": "KubeNodeNotReady", "isRegex": false}]`, DefaultCommentTemplate, true},
+		{"Group durations", `[{"matchers": [{"name": "node", "value": "{{.NodeName}}", "isRegex": false}], "duration": "10m"}, {"matchers": [{"name": "instance", "value": "{{.NodeName}}", "isRegex": false}], "duration": "30m", "delay": "5m"}]`, DefaultCommentTemplate, false},
+		{"Group duration too long", `[{"matchers": [{"name": "node", "value": "{{.NodeName}}", "isRegex": false}], "duration": "48h"}]`, DefaultCommentTemplate, true},
+		{"Group delay and duration too long", `[{"matchers": [{"name": "node", "value": "{{.NodeName}}", "isRegex": false}], "duration": "12h", "delay": "13h"}]`, DefaultCommentTemplate, true},
+		{"Group duration too short", `[{"matchers": [{"name": "node", "value": "{{.NodeName}}", "isRegex": false}], "duration": "1s"}]`, DefaultCommentTemplate, true},
+		{"Negative group delay", `[{"matchers": [{"name": "node", "value": "{{.NodeName}}", "isRegex": false}], "delay": "-5m"}]`, DefaultCommentTemplate, true},
+		{"Invalid group duration", `[{"matchers": [{"name": "node", "value": "{{.NodeName}}", "isRegex": false}], "duration": "ten minutes"}]`, DefaultCommentTemplate, true},
+		{"Invalid comment template", `[{"name": "instance", "value": "{{.NodeName}}", "isRegex": false}]`, "{{.NodeName", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Config{MatchersJSON: tt.matchersJSON, CreatedBy: DefaultCreatedBy, CommentTemplate: tt.comment}.Validate(TemplateData{ClusterName: "test"}, time.Minute, 24*time.Hour)
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestMatcherString(t *testing.T) {
+	tests := []struct {
+		name    string
+		matcher *models.Matcher
+		want    string
+	}{
+		{"Equal", &models.Matcher{Name: ptr.String("instance"), Value: ptr.String("node1"), IsRegex: ptr.Bool(false)}, `instance="node1"`},
+		{"Regex", &models.Matcher{Name: ptr.String("instance"), Value: ptr.String("node.*"), IsRegex: ptr.Bool(true)}, `instance=~"node.*"`},
+		{"Not Equal", &models.Matcher{Name: ptr.String("severity"), Value: ptr.String("critical"), IsRegex: ptr.Bool(false), IsEqual: ptr.Bool(false)}, `severity!="critical"`},
+		{"Not Regex", &models.Matcher{Name: ptr.String("alertname"), Value: ptr.String("Watchdog|InfoInhibitor"), IsRegex: ptr.Bool(true), IsEqual: ptr.Bool(false)}, `alertname!~"Watchdog|InfoInhibitor"`},
+		{"Missing IsRegex", &models.Matcher{Name: ptr.String("instance"), Value: ptr.String("node1")}, `instance="node1"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, matcherString(tt.matcher))
+		})
+	}
+}
+
+func TestGenerateComment(t *testing.T) {
+	lockCreated := time.Date(2024, time.May, 31, 6, 31, 37, 0, time.UTC)
+	data := TemplateData{
+		NodeName:      "node1",
+		ClusterName:   "prod",
+		SilencerPod:   "kured-alert-silencer-abc",
+		LockCreated:   lockCreated,
+		LockMetadata:  map[string]interface{}{"unschedulable": true},
+		Unschedulable: true,
+	}
+
+	tests := []struct {
+		name      string
+		template  string
+		want      string
+		expectErr bool
+	}{
+		{"Default Template", DefaultCommentTemplate, "Silencing during node reboot: node1", false},
+		{
+			"Custom Template",
+			`{{.ClusterName}}/{{.NodeName}} locked at {{.LockCreated.Format "2006-01-02T15:04:05Z07:00"}} by {{.SilencerPod}}, see https://runbooks.example.com/kured`,
+			"prod/node1 locked at 2024-05-31T06:31:37Z by kured-alert-silencer-abc, see https://runbooks.example.com/kured",
+			false,
+		},
+		{"Lock Metadata", `{{if .Unschedulable}}cordoned before reboot{{end}} {{.LockMetadata.unschedulable}}`, "cordoned before reboot true", false},
+		{"Invalid Template", "{{.NodeName", "", true},
+		{"Unknown Field", "{{.Unknown}}", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comment, err := generateComment(tt.template, data)
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, comment)
 			}
 		})
 	}
@@ -72,7 +212,7 @@ func TestNewAlertmanagerClient(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			client, err := NewAlertmanagerClient(tt.alertmanagerURL)
+			client, err := NewAlertmanagerClient(tt.alertmanagerURL, DefaultRequestTimeout)
 			if tt.expectErr {
 				assert.Error(t, err)
 			} else {
@@ -126,6 +266,24 @@ func TestSilenceExistsUntil(t *testing.T) {
 			alertEnd:         time.Now(),
 			expectedExists:   true,
 		},
+		{
+			name: "Existing Silences with additional matchers",
+			existingSilences: []*models.GettableSilence{
+				{
+					Silence: models.Silence{
+						Matchers: []*models.Matcher{
+							{Name: ptr.String("instance"), Value: ptr.String("node1")},
+							{Name: ptr.String("alertname"), Value: ptr.String("RebootRequired")},
+						},
+						StartsAt: (*strfmt.DateTime)(ptr.Time(time.Now().Add(-1 * time.Hour))),
+						EndsAt:   (*strfmt.DateTime)(ptr.Time(time.Now().Add(1 * time.Hour))),
+					},
+				},
+			},
+			matcher:        &models.Matcher{Name: ptr.String("instance"), Value: ptr.String("node1")},
+			alertEnd:       time.Now(),
+			expectedExists: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -133,10 +291,10 @@ func TestSilenceExistsUntil(t *testing.T) {
 			server := mockAlertmanagerServer(tt.existingSilences)
 			defer server.Close()
 
-			alertmanager, err := NewAlertmanagerClient(server.URL)
+			alertmanager, err := NewAlertmanagerClient(server.URL, DefaultRequestTimeout)
 			assert.NoError(t, err)
 
-			exists, err := silenceExistsUntil(alertmanager, tt.matcher, tt.alertEnd)
+			exists, err := silenceExistsUntil(context.Background(), NewAlertmanagerSilencer(alertmanager), []*models.Matcher{tt.matcher}, tt.alertEnd)
 			assert.NoError(t, err)
 			assert.Equal(t, tt.expectedExists, exists)
 		})
@@ -161,10 +319,10 @@ func TestSilenceAlerts(t *testing.T) {
 	server := mockAlertmanagerServer(existingSilences)
 	defer server.Close()
 
-	alertmanager, err := NewAlertmanagerClient(server.URL)
+	alertmanager, err := NewAlertmanagerClient(server.URL, DefaultRequestTimeout)
 	assert.NoError(t, err)
 
-	validMatchersJSON := `[{"name": "instance", "value": "{{.NodeName}}", "isRegex": false}, {"name": "alertname", "value": "node_reboot", "isRegex": false}]`
+	validMatchersJSON := `[{"matchers": [{"name": "instance", "value": "{{.NodeName}}", "isRegex": false}]}, {"matchers": [{"name": "instance", "value": "{{.NodeName}}", "isRegex": false}, {"name": "alertname", "value": "node_reboot", "isRegex": false}]}]`
 	invalidMatchersJSON := `[{name: "instance", "value": "{{.NodeName}}", "isRegex": false}]`
 
 	tests := []struct {
@@ -177,11 +335,18 @@ func TestSilenceAlerts(t *testing.T) {
 		{"Valid Silence", validMatchersJSON, "node1", time.Date(2024, time.May, 31, 0, 0, 0, 0, time.UTC), false},
 		{"Invalid Matchers JSON", invalidMatchersJSON, "node1", time.Date(2024, time.May, 31, 0, 0, 0, 0, time.UTC), true},
 		{"Existing Silence", validMatchersJSON, "node1", time.Date(2024, time.May, 31, 0, 0, 0, 0, time.UTC), false},
+		// each matcher of a flat list is its own silence, alertname alone silences the alerts of every node
+		{"Flat matchers without node", `[{"name": "instance", "value": "{{.NodeName}}", "isRegex": false}, {"name": "alertname", "value": "node_reboot", "isRegex": false}]`, "node1", time.Date(2024, time.May, 31, 0, 0, 0, 0, time.UTC), true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := SilenceAlerts(alertmanager, tt.matchersJSON, tt.nodeName, tt.alertEnd)
+			config := Config{
+				MatchersJSON:    tt.matchersJSON,
+				CreatedBy:       DefaultCreatedBy,
+				CommentTemplate: DefaultCommentTemplate,
+			}
+			_, err := SilenceAlerts(context.Background(), NewAlertmanagerSilencer(alertmanager), config, TemplateData{NodeName: tt.nodeName}, tt.alertEnd.Add(-time.Hour), tt.alertEnd.Add(-time.Hour), tt.alertEnd)
 			if tt.expectErr {
 				assert.Error(t, err)
 			} else {
@@ -190,3 +355,292 @@ func TestSilenceAlerts(t *testing.T) {
 		})
 	}
 }
+
+func TestIdentifies(t *testing.T) {
+	tests := []struct {
+		name    string
+		matcher *models.Matcher
+		value   string
+		want    bool
+	}{
+		{"Equal value", &models.Matcher{Name: ptr.String("instance"), Value: ptr.String("n1"), IsRegex: ptr.Bool(false)}, "n1", true},
+		{"Value containing it", &models.Matcher{Name: ptr.String("instance"), Value: ptr.String("prod-n10"), IsRegex: ptr.Bool(false)}, "n1", false},
+		{"Regex matching it", &models.Matcher{Name: ptr.String("instance"), Value: ptr.String("n1(:[0-9]+)?"), IsRegex: ptr.Bool(true)}, "n1", true},
+		{"Regex anchored on it", &models.Matcher{Name: ptr.String("instance"), Value: ptr.String(`n1\.example\.com:.*`), IsRegex: ptr.Bool(true)}, "n1", true},
+		{"Regex anchored on its pods", &models.Matcher{Name: ptr.String("pod"), Value: ptr.String(`web-[a-z0-9]{5}`), IsRegex: ptr.Bool(true)}, "web", true},
+		{"Regex on a longer name", &models.Matcher{Name: ptr.String("instance"), Value: ptr.String("n10.*"), IsRegex: ptr.Bool(true)}, "n1", false},
+		{"Regex containing it", &models.Matcher{Name: ptr.String("instance"), Value: ptr.String("prod-n1.*"), IsRegex: ptr.Bool(true)}, "n1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identified, err := identifies(tt.matcher, tt.value)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, identified)
+		})
+	}
+}
+
+func TestSilenceAlertsBroadMatchers(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	silencer := NewFakeSilencer(func() time.Time {
+		return now
+	})
+
+	tests := []struct {
+		name         string
+		matchersJSON string
+		nodeName     string
+	}{
+		{"Empty node name", `[{"matchers": [{"name": "alertname", "value": "KubeNodeNotReady", "isRegex": false}, {"name": "node", "value": "{{.NodeName}}-{{.ClusterName}}", "isRegex": false}]}]`, ""},
+		{"No node matcher", `[{"name": "instance", "value": "{{.NodeName}}", "isRegex": false}, {"name": "alertname", "value": "KubeNodeNotReady", "isRegex": false}]`, "node1"},
+		{"Regex matching a canary", `[{"name": "instance", "value": "{{.NodeName}}|prometheus-.*", "isRegex": true}]`, "node1"},
+		{"Node name inside another value", `[{"name": "instance", "value": "prod-n10", "isRegex": false}]`, "n1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{
+				MatchersJSON:    tt.matchersJSON,
+				CreatedBy:       DefaultCreatedBy,
+				CommentTemplate: DefaultCommentTemplate,
+				CanaryValues:    []string{"prometheus-0", "alertmanager-0"},
+			}
+			_, err := SilenceAlerts(context.Background(), silencer, config, TemplateData{NodeName: tt.nodeName, ClusterName: "test"}, now, now, now.Add(time.Hour))
+			assert.ErrorIs(t, err, ErrBroadMatchers)
+		})
+	}
+	// no silence is created when any of them is too broad
+	assert.Empty(t, silencer.Silences())
+
+	config := Config{
+		MatchersJSON:    `[{"name": "instance", "value": "{{.NodeName}}(:[0-9]+)?", "isRegex": true}]`,
+		CreatedBy:       DefaultCreatedBy,
+		CommentTemplate: DefaultCommentTemplate,
+		CanaryValues:    []string{"prometheus-0", "node10"},
+	}
+	_, err := SilenceAlerts(context.Background(), silencer, config, TemplateData{NodeName: "node1"}, now, now, now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, silencer.Silences(), 1)
+}
+
+func TestSilenceAlertsGroupWindows(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	silencer := NewFakeSilencer(func() time.Time {
+		return now
+	})
+	config := Config{
+		MatchersJSON: `[{"matchers": [{"name": "alertname", "value": "KubeNodeNotReady", "isRegex": false}, {"name": "node", "value": "{{.NodeName}}", "isRegex": false}], "duration": "10m"}, ` +
+			`{"matchers": [{"name": "alertname", "value": "KubeDaemonSetRolloutStuck", "isRegex": false}, {"name": "node", "value": "{{.NodeName}}", "isRegex": false}], "duration": "30m", "delay": "5m"}, ` +
+			`{"matchers": [{"name": "instance", "value": "{{.NodeName}}", "isRegex": false}]}]`,
+		CreatedBy:       DefaultCreatedBy,
+		CommentTemplate: DefaultCommentTemplate,
+	}
+
+	changes, err := SilenceAlerts(context.Background(), silencer, config, TemplateData{NodeName: "node1"}, now, now, now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
+	windows := map[string][2]time.Time{}
+	for _, change := range changes {
+		windows[change.MatchersString()] = [2]time.Time{change.StartsAt, change.EndsAt}
+	}
+	assert.Equal(t, map[string][2]time.Time{
+		`{alertname="KubeNodeNotReady", node="node1"}`:          {now, now.Add(10 * time.Minute)},
+		`{alertname="KubeDaemonSetRolloutStuck", node="node1"}`: {now.Add(5 * time.Minute), now.Add(35 * time.Minute)},
+		`{instance="node1"}`: {now, now.Add(time.Hour)},
+	}, windows)
+
+	// the group windows over already are skipped when the node window is extended
+	changes, err = SilenceAlerts(context.Background(), silencer, config, TemplateData{NodeName: "node1"}, now, now.Add(-time.Hour), now.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, `{instance="node1"}`, changes[0].MatchersString())
+	assert.Equal(t, ChangeExtended, changes[0].Action)
+}
+
+func TestSilenceAlertsChanges(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	silencer := NewFakeSilencer(func() time.Time {
+		return now
+	})
+	config := Config{
+		MatchersJSON:    `[{"name": "instance", "value": "{{.NodeName}}", "isRegex": false}]`,
+		CreatedBy:       DefaultCreatedBy,
+		CommentTemplate: DefaultCommentTemplate,
+	}
+	ctx := context.Background()
+
+	changes, err := SilenceAlerts(ctx, silencer, config, TemplateData{NodeName: "node1"}, now, now, now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, ChangeCreated, changes[0].Action)
+	assert.Equal(t, "00000000-0000-0000-0000-000000000001", changes[0].ID)
+	assert.Equal(t, `{instance="node1"}`, changes[0].MatchersString())
+
+	changes, err = SilenceAlerts(ctx, silencer, config, TemplateData{NodeName: "node1"}, now, now, now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	changes, err = SilenceAlerts(ctx, silencer, config, TemplateData{NodeName: "node1"}, now, now, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, ChangeExtended, changes[0].Action)
+
+	// a silence that already ended is created again
+	now = now.Add(3 * time.Hour)
+	changes, err = SilenceAlerts(ctx, silencer, config, TemplateData{NodeName: "node1"}, now, now, now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, ChangeCreated, changes[0].Action)
+}
+
+func TestSilenceAlertsErrAlertmanager(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	alertmanager, err := NewAlertmanagerClient(server.URL, DefaultRequestTimeout)
+	assert.NoError(t, err)
+
+	config := Config{
+		MatchersJSON:    `[{"name": "instance", "value": "{{.NodeName}}", "isRegex": false}]`,
+		CreatedBy:       DefaultCreatedBy,
+		CommentTemplate: DefaultCommentTemplate,
+	}
+	alertEnd := time.Date(2024, time.May, 31, 0, 0, 0, 0, time.UTC)
+
+	_, err = SilenceAlerts(context.Background(), NewAlertmanagerSilencer(alertmanager), config, TemplateData{NodeName: "node1"}, alertEnd.Add(-time.Hour), alertEnd.Add(-time.Hour), alertEnd)
+	assert.ErrorIs(t, err, ErrAlertmanager)
+	assert.ErrorIs(t, err, ErrRetryable)
+
+	config.MatchersJSON = `[{name: "instance"}]`
+	_, err = SilenceAlerts(context.Background(), NewAlertmanagerSilencer(alertmanager), config, TemplateData{NodeName: "node1"}, alertEnd.Add(-time.Hour), alertEnd.Add(-time.Hour), alertEnd)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrRetryable)
+}
+
+func TestAlertmanagerClientTimeout(t *testing.T) {
+	// the responses are held until released, the client giving up first
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode([]*models.GettableSilence{})
+	}))
+	defer server.Close()
+
+	alertmanager, err := NewAlertmanagerClient(server.URL, 50*time.Millisecond)
+	assert.NoError(t, err)
+
+	_, err = silenceExistsUntil(context.Background(), NewAlertmanagerSilencer(alertmanager), []*models.Matcher{{Name: ptr.String("instance"), Value: ptr.String("node1")}}, time.Now())
+	assert.ErrorIs(t, err, ErrAlertmanager)
+
+	close(release)
+	alertmanager, err = NewAlertmanagerClient(server.URL, time.Second)
+	assert.NoError(t, err)
+
+	_, err = silenceExistsUntil(context.Background(), NewAlertmanagerSilencer(alertmanager), []*models.Matcher{{Name: ptr.String("instance"), Value: ptr.String("node1")}}, time.Now())
+	assert.NoError(t, err)
+}
+
+// fakeAlertmanagerClient records the posted silences without HTTP
+type fakeAlertmanagerClient struct {
+	AlertmanagerClient
+	posted []*models.PostableSilence
+}
+
+func (f *fakeAlertmanagerClient) GetSilences(params *silence.GetSilencesParams, opts ...silence.ClientOption) (*silence.GetSilencesOK, error) {
+	return &silence.GetSilencesOK{Payload: models.GettableSilences{}}, nil
+}
+
+func (f *fakeAlertmanagerClient) PostSilences(params *silence.PostSilencesParams, opts ...silence.ClientOption) (*silence.PostSilencesOK, error) {
+	f.posted = append(f.posted, params.Silence)
+	return &silence.PostSilencesOK{}, nil
+}
+
+func TestSilenceAlertsFakeClient(t *testing.T) {
+	alertmanager := &fakeAlertmanagerClient{}
+	config := Config{
+		MatchersJSON:    `[{"matchers": [{"name": "instance", "value": "{{.NodeName}}", "isRegex": false}, {"name": "alertname", "value": "node_reboot", "isRegex": false}]}]`,
+		CreatedBy:       DefaultCreatedBy,
+		CommentTemplate: DefaultCommentTemplate,
+	}
+	alertEnd := time.Date(2024, time.May, 31, 0, 0, 0, 0, time.UTC)
+
+	_, err := SilenceAlerts(context.Background(), NewAlertmanagerSilencer(alertmanager), config, TemplateData{NodeName: "node1"}, alertEnd.Add(-time.Hour), alertEnd.Add(-time.Hour), alertEnd)
+	assert.NoError(t, err)
+	assert.Len(t, alertmanager.posted, 1)
+	assert.Equal(t, `{instance="node1", alertname="node_reboot"}`, matchersString(alertmanager.posted[0].Matchers))
+	assert.Equal(t, "Silencing during node reboot: node1", *alertmanager.posted[0].Comment)
+}
+
+func TestSilenceKeys(t *testing.T) {
+	config := Config{
+		MatchersJSON: `[{"matchers": [{"name": "instance", "value": "{{.NodeName}}", "isRegex": false}, {"name": "alertname", "value": "node_.*", "isRegex": true}]}, ` +
+			`{"matchers": [{"name": "node", "value": "{{.NodeName}}", "isRegex": false}]}]`,
+	}
+
+	keys, err := SilenceKeys(config, TemplateData{NodeName: "node1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`{alertname=~"node_.*", instance="node1"}`, `{node="node1"}`}, keys)
+
+	_, err = SilenceKeys(Config{MatchersJSON: `[{name: "instance"}]`}, TemplateData{NodeName: "node1"})
+	assert.Error(t, err)
+}
+
+func TestExpireOrphanedSilences(t *testing.T) {
+	newSilence := func(id string, createdBy string, state string, nodeName string) *models.GettableSilence {
+		return &models.GettableSilence{
+			ID:     ptr.String(id),
+			Status: &models.SilenceStatus{State: ptr.String(state)},
+			Silence: models.Silence{
+				Matchers: []*models.Matcher{
+					{Name: ptr.String("instance"), Value: ptr.String(nodeName), IsRegex: ptr.Bool(false)},
+				},
+				CreatedBy: ptr.String(createdBy),
+			},
+		}
+	}
+	existingSilences := []*models.GettableSilence{
+		newSilence("7b5c1c3e-0f5d-4a4e-9d3a-1f6f7a8b9c01", DefaultCreatedBy, models.SilenceStatusStateActive, "node1"),
+		newSilence("7b5c1c3e-0f5d-4a4e-9d3a-1f6f7a8b9c02", DefaultCreatedBy, models.SilenceStatusStateActive, "node2"),
+		newSilence("7b5c1c3e-0f5d-4a4e-9d3a-1f6f7a8b9c03", DefaultCreatedBy, models.SilenceStatusStatePending, "node3"),
+		newSilence("7b5c1c3e-0f5d-4a4e-9d3a-1f6f7a8b9c04", DefaultCreatedBy, models.SilenceStatusStateExpired, "node4"),
+		newSilence("7b5c1c3e-0f5d-4a4e-9d3a-1f6f7a8b9c05", "someone", models.SilenceStatusStateActive, "node5"),
+	}
+
+	var mu sync.Mutex
+	deleted := []string{}
+	handler := http.NewServeMux()
+	handler.HandleFunc("/api/v2/silences", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(existingSilences)
+	})
+	handler.HandleFunc("/api/v2/silence/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == "DELETE" {
+			deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/api/v2/silence/"))
+			w.WriteHeader(http.StatusOK)
+		}
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	alertmanager, err := NewAlertmanagerClient(server.URL, DefaultRequestTimeout)
+	assert.NoError(t, err)
+
+	expired, err := ExpireOrphanedSilences(context.Background(), NewAlertmanagerSilencer(alertmanager), DefaultCreatedBy, func(s Silence) bool {
+		return s.Key() == `{instance="node1"}`
+	})
+	assert.NoError(t, err)
+	assert.Len(t, expired, 2)
+	assert.Equal(t, []string{"7b5c1c3e-0f5d-4a4e-9d3a-1f6f7a8b9c02", "7b5c1c3e-0f5d-4a4e-9d3a-1f6f7a8b9c03"}, deleted)
+}
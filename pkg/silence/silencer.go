@@ -0,0 +1,228 @@
+package silence
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/aws/smithy-go/ptr"
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/strfmt"
+	"github.com/prometheus/alertmanager/api/v2/client/silence"
+	"github.com/prometheus/alertmanager/api/v2/models"
+)
+
+// Silence is a silence managed by a Silencer
+type Silence struct {
+	ID        string
+	Matchers  []*models.Matcher
+	StartsAt  time.Time
+	EndsAt    time.Time
+	CreatedBy string
+	Comment   string
+	// State is one of the models.SilenceStatusState values, set by the Silencer when listing silences
+	State string
+}
+
+// MatchersString formats the matchers of the silence the way Alertmanager displays them
+func (s Silence) MatchersString() string {
+	return matchersString(s.Matchers)
+}
+
+// Key identifies the silence by its matchers, regardless of their order
+func (s Silence) Key() string {
+	return silenceKey(s.Matchers)
+}
+
+// nameCharacters are the characters of the node names, a node is referenced when its name is not surrounded by them
+const nameCharacters = "A-Za-z0-9_-"
+
+// References reports whether a matcher value or the comment of the silence mentions the node name, as is or quoted
+// for a regex, e.g. the pod silences of a node whose comment renders {{.NodeName}}
+func (s Silence) References(nodeName string) bool {
+	if nodeName == "" {
+		return false
+	}
+	re := regexp.MustCompile(fmt.Sprintf(`(^|[^%s])(%s|%s)($|[^%s])`, nameCharacters, regexp.QuoteMeta(nodeName), regexp.QuoteMeta(regexp.QuoteMeta(nodeName)), nameCharacters))
+	if re.MatchString(s.Comment) {
+		return true
+	}
+	for _, matcher := range s.Matchers {
+		if matcher.Value != nil && re.MatchString(*matcher.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Silencer creates, updates, expires and lists silences on an alerting backend
+type Silencer interface {
+	// ListSilences returns the silences with at least the given matchers, all the silences without matchers
+	ListSilences(ctx context.Context, matchers []*models.Matcher) ([]Silence, error)
+	// CreateSilence creates the silence and returns its ID
+	CreateSilence(ctx context.Context, s Silence) (string, error)
+	// UpdateSilence replaces the silence with the same ID
+	UpdateSilence(ctx context.Context, s Silence) error
+	// ExpireSilence ends the silence now
+	ExpireSilence(ctx context.Context, id string) error
+}
+
+// hasMatchers reports whether the silence has each of the matchers
+func hasMatchers(s Silence, matchers []*models.Matcher) bool {
+	for _, matcher := range matchers {
+		found := false
+		for _, silenceMatcher := range s.Matchers {
+			if matcherString(silenceMatcher) == matcherString(matcher) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// TenantHeader is the header carrying the tenant ID of multi-tenant Alertmanagers such as Mimir and Cortex
+const TenantHeader = "X-Scope-OrgID"
+
+type tenantKey struct{}
+
+// WithTenant returns a context sending the tenant ID on the requests of an AlertmanagerSilencer,
+// overriding the tenant of the silencer
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant ID set with WithTenant, empty when none is set
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// AlertmanagerSilencer manages silences through the Alertmanager v2 API, wrapping its errors with ErrAlertmanager
+// marked with ErrRetryable
+type AlertmanagerSilencer struct {
+	client AlertmanagerClient
+	// tenant is sent in the TenantHeader of every request when set
+	tenant string
+}
+
+func NewAlertmanagerSilencer(client AlertmanagerClient) *AlertmanagerSilencer {
+	return &AlertmanagerSilencer{client: client}
+}
+
+// WithTenant sets the tenant ID sent on every request
+func (a *AlertmanagerSilencer) WithTenant(tenant string) *AlertmanagerSilencer {
+	a.tenant = tenant
+	return a
+}
+
+// options returns the client options of a request, adding the tenant header of the context or of the silencer
+func (a *AlertmanagerSilencer) options(ctx context.Context) []silence.ClientOption {
+	tenant := a.tenant
+	if ctxTenant := TenantFromContext(ctx); ctxTenant != "" {
+		tenant = ctxTenant
+	}
+	if tenant == "" {
+		return nil
+	}
+
+	return []silence.ClientOption{func(operation *runtime.ClientOperation) {
+		params := operation.Params
+		operation.Params = runtime.ClientRequestWriterFunc(func(r runtime.ClientRequest, registry strfmt.Registry) error {
+			if err := params.WriteToRequest(r, registry); err != nil {
+				return err
+			}
+			return r.SetHeaderParam(TenantHeader, tenant)
+		})
+	}}
+}
+
+// withoutTimeout removes the default 30s timeout of the request params, each request being bounded by the timeout of
+// the HTTP client of NewAlertmanagerClient and by the context
+func withoutTimeout[P interface{ SetTimeout(time.Duration) }](params P) P {
+	params.SetTimeout(0)
+	return params
+}
+
+func (a *AlertmanagerSilencer) ListSilences(ctx context.Context, matchers []*models.Matcher) ([]Silence, error) {
+	filter := []string{}
+	for _, matcher := range matchers {
+		filter = append(filter, matcherString(matcher))
+	}
+
+	getSilencesParams := withoutTimeout(silence.NewGetSilencesParamsWithContext(ctx)).WithFilter(filter)
+	getSilencesResp, err := a.client.GetSilences(getSilencesParams, a.options(ctx)...)
+	if err != nil {
+		return nil, alertmanagerError(err)
+	}
+
+	silences := []Silence{}
+	for _, gettableSilence := range getSilencesResp.Payload {
+		s := Silence{
+			ID:        ptr.ToString(gettableSilence.ID),
+			Matchers:  gettableSilence.Matchers,
+			CreatedBy: ptr.ToString(gettableSilence.CreatedBy),
+			Comment:   ptr.ToString(gettableSilence.Comment),
+		}
+		if gettableSilence.StartsAt != nil {
+			s.StartsAt = time.Time(*gettableSilence.StartsAt)
+		}
+		if gettableSilence.EndsAt != nil {
+			s.EndsAt = time.Time(*gettableSilence.EndsAt)
+		}
+		if gettableSilence.Status != nil {
+			s.State = ptr.ToString(gettableSilence.Status.State)
+		}
+		silences = append(silences, s)
+	}
+	return silences, nil
+}
+
+// postSilence creates the silence, or updates it when it has an ID
+func (a *AlertmanagerSilencer) postSilence(ctx context.Context, s Silence) (string, error) {
+	postableSilence := &models.PostableSilence{
+		ID: s.ID,
+		Silence: models.Silence{
+			Matchers:  s.Matchers,
+			StartsAt:  (*strfmt.DateTime)(ptr.Time(s.StartsAt)),
+			EndsAt:    (*strfmt.DateTime)(ptr.Time(s.EndsAt)),
+			CreatedBy: ptr.String(s.CreatedBy),
+			Comment:   ptr.String(s.Comment),
+		},
+	}
+
+	postSilenceParams := withoutTimeout(silence.NewPostSilencesParamsWithContext(ctx)).WithSilence(postableSilence)
+	postSilenceResp, err := a.client.PostSilences(postSilenceParams, a.options(ctx)...)
+	if err != nil {
+		return "", alertmanagerError(err)
+	}
+	if postSilenceResp == nil || postSilenceResp.Payload == nil {
+		return "", nil
+	}
+	return postSilenceResp.Payload.SilenceID, nil
+}
+
+func (a *AlertmanagerSilencer) CreateSilence(ctx context.Context, s Silence) (string, error) {
+	s.ID = ""
+	return a.postSilence(ctx, s)
+}
+
+func (a *AlertmanagerSilencer) UpdateSilence(ctx context.Context, s Silence) error {
+	if s.ID == "" {
+		return fmt.Errorf("silence to update has no ID")
+	}
+	_, err := a.postSilence(ctx, s)
+	return err
+}
+
+func (a *AlertmanagerSilencer) ExpireSilence(ctx context.Context, id string) error {
+	deleteSilenceParams := withoutTimeout(silence.NewDeleteSilenceParamsWithContext(ctx)).WithSilenceID(strfmt.UUID(id))
+	if _, err := a.client.DeleteSilence(deleteSilenceParams, a.options(ctx)...); err != nil {
+		return alertmanagerError(err)
+	}
+	return nil
+}
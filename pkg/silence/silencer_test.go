@@ -0,0 +1,165 @@
+package silence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go/ptr"
+	"github.com/go-openapi/strfmt"
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlertmanagerSilencer(t *testing.T) {
+	startsAt := time.Date(2024, time.May, 31, 6, 31, 0, 0, time.UTC)
+	endsAt := startsAt.Add(time.Hour)
+
+	var posted []*models.PostableSilence
+	var deleted []string
+	handler := http.NewServeMux()
+	handler.HandleFunc("/api/v2/silences", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "GET" {
+			assert.Equal(t, []string{`instance="node1"`}, r.URL.Query()["filter"])
+			json.NewEncoder(w).Encode([]*models.GettableSilence{
+				{
+					ID:     ptr.String("00000000-0000-0000-0000-000000000001"),
+					Status: &models.SilenceStatus{State: ptr.String(models.SilenceStatusStateActive)},
+					Silence: models.Silence{
+						Matchers:  []*models.Matcher{{Name: ptr.String("instance"), Value: ptr.String("node1"), IsRegex: ptr.Bool(false)}},
+						StartsAt:  (*strfmt.DateTime)(ptr.Time(startsAt)),
+						EndsAt:    (*strfmt.DateTime)(ptr.Time(endsAt)),
+						CreatedBy: ptr.String(DefaultCreatedBy),
+						Comment:   ptr.String("comment"),
+					},
+				},
+			})
+		} else if r.Method == "POST" {
+			postable := &models.PostableSilence{}
+			json.NewDecoder(r.Body).Decode(postable)
+			posted = append(posted, postable)
+			json.NewEncoder(w).Encode(map[string]string{"silenceID": "00000000-0000-0000-0000-000000000002"})
+		}
+	})
+	handler.HandleFunc("/api/v2/silence/00000000-0000-0000-0000-000000000001", func(w http.ResponseWriter, r *http.Request) {
+		deleted = append(deleted, r.Method)
+		w.WriteHeader(http.StatusOK)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	client, err := NewAlertmanagerClient(server.URL, DefaultRequestTimeout)
+	require.NoError(t, err)
+	silencer := NewAlertmanagerSilencer(client)
+	ctx := context.Background()
+	matchers := []*models.Matcher{{Name: ptr.String("instance"), Value: ptr.String("node1"), IsRegex: ptr.Bool(false)}}
+
+	silences, err := silencer.ListSilences(ctx, matchers)
+	require.NoError(t, err)
+	require.Len(t, silences, 1)
+	assert.Equal(t, Silence{
+		ID:        "00000000-0000-0000-0000-000000000001",
+		Matchers:  matchers,
+		StartsAt:  startsAt,
+		EndsAt:    endsAt,
+		CreatedBy: DefaultCreatedBy,
+		Comment:   "comment",
+		State:     models.SilenceStatusStateActive,
+	}, silences[0])
+
+	id, err := silencer.CreateSilence(ctx, Silence{ID: "ignored", Matchers: matchers, StartsAt: startsAt, EndsAt: endsAt, CreatedBy: DefaultCreatedBy})
+	require.NoError(t, err)
+	assert.Equal(t, "00000000-0000-0000-0000-000000000002", id)
+	require.Len(t, posted, 1)
+	assert.Empty(t, posted[0].ID)
+
+	silences[0].EndsAt = endsAt.Add(time.Hour)
+	err = silencer.UpdateSilence(ctx, silences[0])
+	require.NoError(t, err)
+	require.Len(t, posted, 2)
+	assert.Equal(t, "00000000-0000-0000-0000-000000000001", posted[1].ID)
+	assert.Equal(t, endsAt.Add(time.Hour), time.Time(*posted[1].EndsAt))
+
+	err = silencer.UpdateSilence(ctx, Silence{})
+	require.Error(t, err)
+
+	err = silencer.ExpireSilence(ctx, "00000000-0000-0000-0000-000000000001")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"DELETE"}, deleted)
+
+	err = silencer.ExpireSilence(ctx, "00000000-0000-0000-0000-000000000003")
+	assert.ErrorIs(t, err, ErrAlertmanager)
+}
+
+func TestFakeSilencer(t *testing.T) {
+	now := time.Date(2024, time.May, 31, 6, 40, 0, 0, time.UTC)
+	silencer := NewFakeSilencer(func() time.Time {
+		return now
+	})
+	ctx := context.Background()
+	node1 := []*models.Matcher{{Name: ptr.String("instance"), Value: ptr.String("node1"), IsRegex: ptr.Bool(false)}}
+	node2 := []*models.Matcher{
+		{Name: ptr.String("instance"), Value: ptr.String("node2"), IsRegex: ptr.Bool(false)},
+		{Name: ptr.String("alertname"), Value: ptr.String("Reboot.*"), IsRegex: ptr.Bool(true)},
+	}
+
+	// a start in the past is moved to now like Alertmanager does
+	id1, err := silencer.CreateSilence(ctx, Silence{Matchers: node1, StartsAt: now.Add(-10 * time.Minute), EndsAt: now.Add(time.Hour)})
+	require.NoError(t, err)
+	assert.Equal(t, now, silencer.Silences()[0].StartsAt)
+	_, err = silencer.CreateSilence(ctx, Silence{Matchers: node2, StartsAt: now.Add(time.Minute), EndsAt: now.Add(time.Hour)})
+	require.NoError(t, err)
+
+	silences, err := silencer.ListSilences(ctx, node2[1:])
+	require.NoError(t, err)
+	require.Len(t, silences, 1)
+	assert.Equal(t, models.SilenceStatusStatePending, silences[0].State)
+
+	silences, err = silencer.ListSilences(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, silences, 2)
+	assert.Equal(t, models.SilenceStatusStateActive, silences[0].State)
+
+	silences[0].EndsAt = now.Add(2 * time.Hour)
+	require.NoError(t, silencer.UpdateSilence(ctx, silences[0]))
+	assert.Equal(t, now.Add(2*time.Hour), silencer.Silences()[0].EndsAt)
+
+	require.NoError(t, silencer.ExpireSilence(ctx, id1))
+	assert.Equal(t, models.SilenceStatusStateExpired, silencer.Silences()[0].State)
+	require.Error(t, silencer.ExpireSilence(ctx, "unknown"))
+
+	silencer.SetError(errors.New("unavailable"))
+	_, err = silencer.ListSilences(ctx, nil)
+	assert.ErrorIs(t, err, ErrAlertmanager)
+}
+
+func TestSilenceReferences(t *testing.T) {
+	matcher := func(value string, isRegex bool) *models.Matcher {
+		return &models.Matcher{Name: ptr.String("instance"), Value: ptr.String(value), IsRegex: ptr.Bool(isRegex)}
+	}
+
+	tests := []struct {
+		name     string
+		silence  Silence
+		nodeName string
+		want     bool
+	}{
+		{"Matcher value", Silence{Matchers: []*models.Matcher{matcher("node1.example.com", false)}}, "node1", true},
+		{"Regex matcher value", Silence{Matchers: []*models.Matcher{matcher(`node1\.example\.com:.*`, true)}}, "node1.example.com", true},
+		{"Comment", Silence{Comment: "Silencing during node reboot: node1"}, "node1", true},
+		{"Other node with the same prefix", Silence{Matchers: []*models.Matcher{matcher("node10", false)}, Comment: "node1-backup"}, "node1", false},
+		{"Pod silence without node", Silence{Matchers: []*models.Matcher{matcher("web-6d4cf56db6-abcde", false)}}, "node1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.silence.References(tt.nodeName))
+		})
+	}
+}
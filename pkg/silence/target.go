@@ -0,0 +1,265 @@
+package silence
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template/parse"
+	"time"
+
+	"github.com/go-openapi/runtime"
+	httptransport "github.com/go-openapi/runtime/client"
+	"github.com/go-openapi/strfmt"
+	"github.com/prometheus/alertmanager/api/v2/client"
+)
+
+const (
+	// TargetTypeAlertmanager is a Prometheus Alertmanager, serving its API under /api/v2
+	TargetTypeAlertmanager = "alertmanager"
+	// TargetTypeGrafana is the Grafana-managed Alertmanager, serving its API under /api/alertmanager/grafana/api/v2
+	TargetTypeGrafana = "grafana"
+	// TargetTypeMimir is a Grafana Mimir or Cortex Alertmanager, serving its API under /alertmanager/api/v2
+	TargetTypeMimir = "mimir"
+	// TargetTypePagerDuty creates PagerDuty maintenance windows for the services of the target
+	TargetTypePagerDuty = "pagerduty"
+	// TargetTypeOpsgenie creates Opsgenie maintenances disabling the integrations of the target
+	TargetTypeOpsgenie = "opsgenie"
+)
+
+// targetBasePaths are the API paths of each target type, relative to the target URL
+var targetBasePaths = map[string]string{
+	TargetTypeAlertmanager: client.DefaultBasePath,
+	TargetTypeGrafana:      "/api/alertmanager/grafana/api/v2",
+	TargetTypeMimir:        "/alertmanager/api/v2",
+}
+
+// maintenanceURLs are the default URLs of the maintenance window target types
+var maintenanceURLs = map[string]string{
+	TargetTypePagerDuty: DefaultPagerDutyURL,
+	TargetTypeOpsgenie:  DefaultOpsgenieURL,
+}
+
+// Target is an alerting backend receiving the silences
+type Target struct {
+	Name string `json:"name"`
+	// Type is one of the TargetType values, TargetTypeAlertmanager when empty
+	Type string `json:"type,omitempty"`
+	// URL is the address of the backend, the public API for PagerDuty and Opsgenie when empty
+	URL string `json:"url,omitempty"`
+	// BearerTokenFile holds the token sent on every request, e.g. a Grafana service account token,
+	// read on every request so that the token can be rotated
+	BearerTokenFile string `json:"bearerTokenFile,omitempty"`
+	// Username and PasswordFile are the basic auth credentials sent on every request, e.g. for Grafana Cloud
+	Username     string `json:"username,omitempty"`
+	PasswordFile string `json:"passwordFile,omitempty"`
+	// Tenant is the tenant ID sent in the TenantHeader, a Go template with access to the template data
+	// including {{.NodeLabels}}, e.g. `{{index .NodeLabels "example.com/tenant"}}`
+	Tenant string `json:"tenant,omitempty"`
+	// APIKeyFile holds the PagerDuty or Opsgenie API key, read on every request
+	APIKeyFile string `json:"apiKeyFile,omitempty"`
+	// From is the email of the PagerDuty user creating the maintenance windows
+	From string `json:"from,omitempty"`
+	// ServiceIDs are the PagerDuty services put in maintenance
+	ServiceIDs []string `json:"serviceIDs,omitempty"`
+	// IntegrationIDs are the Opsgenie integrations disabled during the maintenances
+	IntegrationIDs []string `json:"integrationIDs,omitempty"`
+}
+
+// RenderTenant renders a tenant template for the given template data
+func RenderTenant(tenant string, data TemplateData) (string, error) {
+	tpl, err := renderTemplate("tenant", tenant, data)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(tpl.String()), nil
+}
+
+// TenantUsesNodeLabels reports whether a tenant template reads the labels of the node, in which case they have to be
+// fetched before rendering it. A template passing the whole data, e.g. to a function, is assumed to read them.
+func TenantUsesNodeLabels(tenant string) (bool, error) {
+	tmpl, err := newTemplate("tenant").Parse(tenant)
+	if err != nil {
+		return false, err
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil && usesNodeLabels(t.Tree.Root) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// usesNodeLabels walks a template parse tree looking for a reference to the NodeLabels field or to the whole data
+func usesNodeLabels(node parse.Node) bool {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return false
+		}
+		for _, child := range n.Nodes {
+			if usesNodeLabels(child) {
+				return true
+			}
+		}
+	case *parse.ActionNode:
+		return usesNodeLabels(n.Pipe)
+	case *parse.PipeNode:
+		if n == nil {
+			return false
+		}
+		for _, cmd := range n.Cmds {
+			if usesNodeLabels(cmd) {
+				return true
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			if usesNodeLabels(arg) {
+				return true
+			}
+		}
+	case *parse.IfNode:
+		return usesNodeLabels(n.Pipe) || usesNodeLabels(n.List) || usesNodeLabels(n.ElseList)
+	case *parse.RangeNode:
+		return usesNodeLabels(n.Pipe) || usesNodeLabels(n.List) || usesNodeLabels(n.ElseList)
+	case *parse.WithNode:
+		return usesNodeLabels(n.Pipe) || usesNodeLabels(n.List) || usesNodeLabels(n.ElseList)
+	case *parse.TemplateNode:
+		return usesNodeLabels(n.Pipe)
+	case *parse.ChainNode:
+		return usesNodeLabels(n.Node) || (len(n.Field) > 0 && n.Field[0] == "NodeLabels")
+	case *parse.FieldNode:
+		return len(n.Ident) > 0 && n.Ident[0] == "NodeLabels"
+	case *parse.VariableNode:
+		// $ is the whole data, $.NodeLabels its labels
+		return n.Ident[0] == "$" && (len(n.Ident) == 1 || n.Ident[1] == "NodeLabels")
+	case *parse.DotNode:
+		return true
+	}
+	return false
+}
+
+// ParseTargets parses and validates the targets from JSON string with format
+// `[{"name": "grafana", "type": "grafana", "url": "https://grafana.example.com", "bearerTokenFile": "/etc/grafana/token"}]`
+func ParseTargets(targetsJSON string) ([]Target, error) {
+	var targets []Target
+	if err := json.Unmarshal([]byte(targetsJSON), &targets); err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no target configured")
+	}
+
+	names := map[string]bool{}
+	for i := range targets {
+		target := &targets[i]
+		if target.Type == "" {
+			target.Type = TargetTypeAlertmanager
+		}
+		_, alertmanager := targetBasePaths[target.Type]
+		defaultURL, maintenance := maintenanceURLs[target.Type]
+		if !alertmanager && !maintenance {
+			return nil, fmt.Errorf("target %q has unknown type %q", target.Name, target.Type)
+		}
+		if target.Name == "" {
+			return nil, fmt.Errorf("target %d has no name", i)
+		}
+		if names[target.Name] {
+			return nil, fmt.Errorf("target %q is configured twice", target.Name)
+		}
+		names[target.Name] = true
+		if target.URL == "" {
+			target.URL = defaultURL
+		}
+		if target.URL == "" {
+			return nil, fmt.Errorf("target %q has no URL", target.Name)
+		}
+		if _, err := newTemplate("tenant").Parse(target.Tenant); err != nil {
+			return nil, fmt.Errorf("target %q has an invalid tenant template: %w", target.Name, err)
+		}
+		if target.BearerTokenFile != "" && target.Username != "" {
+			return nil, fmt.Errorf("target %q has both bearer token and basic auth credentials", target.Name)
+		}
+		if maintenance && target.APIKeyFile == "" {
+			return nil, fmt.Errorf("target %q has no API key file", target.Name)
+		}
+		if target.Type == TargetTypePagerDuty && (target.From == "" || len(target.ServiceIDs) == 0) {
+			return nil, fmt.Errorf("target %q needs the from email and service IDs of the maintenance windows", target.Name)
+		}
+		if target.Type == TargetTypeOpsgenie && len(target.IntegrationIDs) == 0 {
+			return nil, fmt.Errorf("target %q needs the integration IDs of the maintenances", target.Name)
+		}
+	}
+	return targets, nil
+}
+
+// readSecretFile reads a token or password file, ignoring the surrounding whitespace
+func readSecretFile(file string) (string, error) {
+	secret, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(secret)), nil
+}
+
+// Maintenance reports whether the target creates maintenance windows muting whole services rather than silences
+// matching alerts
+func (t Target) Maintenance() bool {
+	_, maintenance := maintenanceURLs[t.Type]
+	return maintenance
+}
+
+// auth returns the credentials writer of the target, nil without credentials
+func (t Target) auth() runtime.ClientAuthInfoWriter {
+	switch {
+	case t.BearerTokenFile != "":
+		return runtime.ClientAuthInfoWriterFunc(func(r runtime.ClientRequest, registry strfmt.Registry) error {
+			token, err := readSecretFile(t.BearerTokenFile)
+			if err != nil {
+				return err
+			}
+			return httptransport.BearerToken(token).AuthenticateRequest(r, registry)
+		})
+	case t.Username != "":
+		return runtime.ClientAuthInfoWriterFunc(func(r runtime.ClientRequest, registry strfmt.Registry) error {
+			password := ""
+			if t.PasswordFile != "" {
+				var err error
+				password, err = readSecretFile(t.PasswordFile)
+				if err != nil {
+					return err
+				}
+			}
+			return httptransport.BasicAuth(t.Username, password).AuthenticateRequest(r, registry)
+		})
+	default:
+		return nil
+	}
+}
+
+// NewTargetSilencer creates the Silencer of the target, each request is bounded by the timeout. A templated tenant is
+// rendered by the caller and passed with WithTenant, a static tenant is sent on every request
+func NewTargetSilencer(target Target, timeout time.Duration) (Silencer, error) {
+	switch target.Type {
+	case TargetTypePagerDuty:
+		return NewPagerDutySilencer(target.URL, target.APIKeyFile, target.From, target.ServiceIDs, timeout), nil
+	case TargetTypeOpsgenie:
+		return NewOpsgenieSilencer(target.URL, target.APIKeyFile, target.IntegrationIDs, timeout), nil
+	}
+
+	basePath, ok := targetBasePaths[target.Type]
+	if !ok {
+		return nil, fmt.Errorf("target %q has unknown type %q", target.Name, target.Type)
+	}
+
+	alertmanager, err := newAlertmanagerClient(target.URL, basePath, timeout, target.auth())
+	if err != nil {
+		return nil, err
+	}
+	silencer := NewAlertmanagerSilencer(alertmanager)
+	if !strings.Contains(target.Tenant, "{{") {
+		silencer.WithTenant(target.Tenant)
+	}
+	return silencer, nil
+}
@@ -0,0 +1,206 @@
+package silence
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTargets(t *testing.T) {
+	tests := []struct {
+		name        string
+		targetsJSON string
+		want        []Target
+		expectErr   bool
+	}{
+		{
+			name:        "default type",
+			targetsJSON: `[{"name": "prometheus", "url": "http://localhost:9093"}]`,
+			want:        []Target{{Name: "prometheus", Type: TargetTypeAlertmanager, URL: "http://localhost:9093"}},
+		},
+		{
+			name: "grafana and mimir",
+			targetsJSON: `[{"name": "grafana", "type": "grafana", "url": "https://grafana.example.com", "bearerTokenFile": "/etc/grafana/token"}, ` +
+				`{"name": "mimir", "type": "mimir", "url": "https://mimir.example.com", "username": "1234", "passwordFile": "/etc/mimir/password"}]`,
+			want: []Target{
+				{Name: "grafana", Type: TargetTypeGrafana, URL: "https://grafana.example.com", BearerTokenFile: "/etc/grafana/token"},
+				{Name: "mimir", Type: TargetTypeMimir, URL: "https://mimir.example.com", Username: "1234", PasswordFile: "/etc/mimir/password"},
+			},
+		},
+		{
+			name: "pagerduty and opsgenie with the public APIs",
+			targetsJSON: `[{"name": "pagerduty", "type": "pagerduty", "apiKeyFile": "/etc/pagerduty/key", "from": "oncall@example.com", "serviceIDs": ["PSERVICE1"]}, ` +
+				`{"name": "opsgenie", "type": "opsgenie", "apiKeyFile": "/etc/opsgenie/key", "integrationIDs": ["integration-1"]}]`,
+			want: []Target{
+				{Name: "pagerduty", Type: TargetTypePagerDuty, URL: DefaultPagerDutyURL, APIKeyFile: "/etc/pagerduty/key", From: "oncall@example.com", ServiceIDs: []string{"PSERVICE1"}},
+				{Name: "opsgenie", Type: TargetTypeOpsgenie, URL: DefaultOpsgenieURL, APIKeyFile: "/etc/opsgenie/key", IntegrationIDs: []string{"integration-1"}},
+			},
+		},
+		{name: "pagerduty without API key", targetsJSON: `[{"name": "pagerduty", "type": "pagerduty", "from": "oncall@example.com", "serviceIDs": ["PSERVICE1"]}]`, expectErr: true},
+		{name: "pagerduty without services", targetsJSON: `[{"name": "pagerduty", "type": "pagerduty", "apiKeyFile": "/key", "from": "oncall@example.com"}]`, expectErr: true},
+		{name: "opsgenie without integrations", targetsJSON: `[{"name": "opsgenie", "type": "opsgenie", "apiKeyFile": "/key"}]`, expectErr: true},
+		{name: "invalid JSON", targetsJSON: `[{name: "prometheus"}]`, expectErr: true},
+		{name: "no target", targetsJSON: `[]`, expectErr: true},
+		{name: "unknown type", targetsJSON: `[{"name": "prometheus", "type": "unknown", "url": "http://localhost:9093"}]`, expectErr: true},
+		{name: "missing name", targetsJSON: `[{"url": "http://localhost:9093"}]`, expectErr: true},
+		{name: "missing URL", targetsJSON: `[{"name": "prometheus"}]`, expectErr: true},
+		{name: "invalid tenant", targetsJSON: `[{"name": "mimir", "type": "mimir", "url": "http://localhost:8080", "tenant": "{{.NodeLabels"}]`, expectErr: true},
+		{
+			name:        "duplicated name",
+			targetsJSON: `[{"name": "prometheus", "url": "http://localhost:9093"}, {"name": "prometheus", "url": "http://localhost:9094"}]`,
+			expectErr:   true,
+		},
+		{
+			name:        "both credentials",
+			targetsJSON: `[{"name": "grafana", "url": "http://localhost:3000", "bearerTokenFile": "/token", "username": "admin"}]`,
+			expectErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets, err := ParseTargets(tt.targetsJSON)
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, targets)
+			}
+		})
+	}
+}
+
+func TestNewTargetSilencer(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("glsa_token\n"), 0o600))
+	passwordFile := filepath.Join(dir, "password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("secret"), 0o600))
+
+	var requestPath, authorization, tenant string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestPath = r.URL.Path
+		authorization = r.Header.Get("Authorization")
+		tenant = r.Header.Get(TenantHeader)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]*models.GettableSilence{})
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name              string
+		target            Target
+		wantPath          string
+		wantAuthorization string
+		wantTenant        string
+	}{
+		{
+			name:     "alertmanager behind a path prefix",
+			target:   Target{Name: "prometheus", Type: TargetTypeAlertmanager, URL: server.URL + "/prometheus"},
+			wantPath: "/prometheus/api/v2/silences",
+		},
+		{
+			name:              "grafana with a service account token",
+			target:            Target{Name: "grafana", Type: TargetTypeGrafana, URL: server.URL, BearerTokenFile: tokenFile},
+			wantPath:          "/api/alertmanager/grafana/api/v2/silences",
+			wantAuthorization: "Bearer glsa_token",
+		},
+		{
+			name:              "mimir with basic auth",
+			target:            Target{Name: "mimir", Type: TargetTypeMimir, URL: server.URL, Username: "1234", PasswordFile: passwordFile},
+			wantPath:          "/alertmanager/api/v2/silences",
+			wantAuthorization: "Basic MTIzNDpzZWNyZXQ=",
+		},
+		{
+			name:       "mimir with a static tenant",
+			target:     Target{Name: "mimir", Type: TargetTypeMimir, URL: server.URL, Tenant: "team-a"},
+			wantPath:   "/alertmanager/api/v2/silences",
+			wantTenant: "team-a",
+		},
+		{
+			name:     "mimir with a templated tenant",
+			target:   Target{Name: "mimir", Type: TargetTypeMimir, URL: server.URL, Tenant: `{{index .NodeLabels "example.com/tenant"}}`},
+			wantPath: "/alertmanager/api/v2/silences",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			silencer, err := NewTargetSilencer(tt.target, time.Second)
+			require.NoError(t, err)
+
+			_, err = silencer.ListSilences(context.Background(), nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantPath, requestPath)
+			assert.Equal(t, tt.wantAuthorization, authorization)
+			assert.Equal(t, tt.wantTenant, tenant)
+		})
+	}
+
+	// the tenant of the context overrides the tenant of the target
+	silencer, err := NewTargetSilencer(Target{Name: "mimir", Type: TargetTypeMimir, URL: server.URL, Tenant: "team-a"}, time.Second)
+	require.NoError(t, err)
+	_, err = silencer.ListSilences(WithTenant(context.Background(), "team-b"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "team-b", tenant)
+
+	silencer, err = NewTargetSilencer(Target{Name: "grafana", Type: TargetTypeGrafana, URL: server.URL, BearerTokenFile: filepath.Join(dir, "missing")}, time.Second)
+	require.NoError(t, err)
+	_, err = silencer.ListSilences(context.Background(), nil)
+	assert.Error(t, err)
+
+	_, err = NewTargetSilencer(Target{Name: "unknown", Type: "unknown", URL: server.URL}, time.Second)
+	assert.Error(t, err)
+}
+
+func TestRenderTenant(t *testing.T) {
+	data := TemplateData{NodeName: "kind-worker", NodeLabels: map[string]string{"example.com/tenant": "team-a"}}
+
+	tenant, err := RenderTenant(`{{index .NodeLabels "example.com/tenant"}}`, data)
+	require.NoError(t, err)
+	assert.Equal(t, "team-a", tenant)
+
+	tenant, err = RenderTenant(`{{index .NodeLabels "example.com/missing"}}`, data)
+	require.NoError(t, err)
+	assert.Equal(t, "", tenant)
+
+	_, err = RenderTenant(`{{.Missing}}`, data)
+	assert.Error(t, err)
+}
+
+func TestTenantUsesNodeLabels(t *testing.T) {
+	tests := []struct {
+		name     string
+		tenant   string
+		expected bool
+	}{
+		{name: "static", tenant: "team-a", expected: false},
+		{name: "cluster name", tenant: "{{.ClusterName}}", expected: false},
+		{name: "index", tenant: `{{index .NodeLabels "example.com/tenant"}}`, expected: true},
+		{name: "pipeline", tenant: `{{ index .NodeLabels "example.com/tenant" | printf "team-%s" }}`, expected: true},
+		{name: "with", tenant: `{{with .NodeLabels}}{{index . "example.com/tenant"}}{{end}}`, expected: true},
+		{name: "root variable", tenant: `{{index $.NodeLabels "example.com/tenant"}}`, expected: true},
+		{name: "condition", tenant: `{{if eq .ClusterName "prod"}}{{.NodeLabels.tenant}}{{else}}default{{end}}`, expected: true},
+		{name: "whole data", tenant: `{{printf "%v" .}}`, expected: true},
+		{name: "text mentioning the field", tenant: `NodeLabels-{{.NodeName}}`, expected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uses, err := TenantUsesNodeLabels(tt.tenant)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, uses)
+		})
+	}
+
+	_, err := TenantUsesNodeLabels("{{")
+	assert.Error(t, err)
+}
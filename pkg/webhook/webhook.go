@@ -0,0 +1,244 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/trustyou/kured-alert-silencer/pkg/silence"
+)
+
+const (
+	// EventCreated is sent when silences are created
+	EventCreated = silence.ChangeCreated
+	// EventExtended is sent when silences ending too early are replaced by longer ones
+	EventExtended = silence.ChangeExtended
+	// EventExpired is sent when orphaned silences are expired
+	EventExpired = silence.ChangeExpired
+	// EventFailed is sent when silencing fails, once per request and not on each of its retries
+	EventFailed = "failed"
+
+	// SignatureHeader holds the hex encoded HMAC-SHA256 of the body, prefixed with "sha256="
+	SignatureHeader = "X-Signature-256"
+
+	// DefaultTimeout bounds each webhook request when no timeout is configured
+	DefaultTimeout = 10 * time.Second
+	// DefaultRetries is the number of retries of a failing webhook request when none is configured
+	DefaultRetries = 3
+	// DefaultRetryDelay is the delay before the first retry, doubled after each failure
+	DefaultRetryDelay = time.Second
+
+	// queueSize bounds the events waiting to be sent, newer events are dropped when the webhook is too slow
+	queueSize = 100
+)
+
+// Event is a change of the silences of a node on a target
+type Event struct {
+	// Event is one of the Event values
+	Event   string `json:"event"`
+	Cluster string `json:"cluster"`
+	Target  string `json:"target"`
+	// Node is empty for the silences expired by the cleanup
+	Node       string    `json:"node,omitempty"`
+	Matchers   []string  `json:"matchers"`
+	StartsAt   time.Time `json:"startsAt"`
+	EndsAt     time.Time `json:"endsAt"`
+	SilenceIDs []string  `json:"silenceIDs"`
+	Error      string    `json:"error,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// Config holds the settings of the webhook
+type Config struct {
+	URL string
+	// BodyTemplate is a Go template rendered with the Event, with a json function to encode values,
+	// the Event encoded in JSON when empty
+	BodyTemplate string
+	// SecretFile holds the HMAC key signing the body in the SignatureHeader, read on every request
+	SecretFile string
+	Timeout    time.Duration
+	Retries    int
+	RetryDelay time.Duration
+}
+
+// Sink posts the events to the webhook in the background, in order
+type Sink struct {
+	config   Config
+	client   *http.Client
+	template *template.Template
+
+	mu     sync.Mutex
+	closed bool
+	events chan Event
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates a Sink and starts sending its events
+func New(config Config) (*Sink, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("webhook has no URL")
+	}
+	if config.Timeout == 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if config.RetryDelay == 0 {
+		config.RetryDelay = DefaultRetryDelay
+	}
+
+	var tmpl *template.Template
+	if config.BodyTemplate != "" {
+		var err error
+		tmpl, err = template.New("body").Funcs(template.FuncMap{"json": toJSON}).Parse(config.BodyTemplate)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Sink{
+		config:   config,
+		client:   &http.Client{Timeout: config.Timeout},
+		template: tmpl,
+		events:   make(chan Event, queueSize),
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// toJSON encodes a value for the body template, e.g. {"text": {{printf "%s %s" .Event .Node | json}}}
+func toJSON(v any) (string, error) {
+	encoded, err := json.Marshal(v)
+	return string(encoded), err
+}
+
+// Notify queues the event, dropping it when the queue is full or the sink is closed
+func (s *Sink) Notify(event Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		log.Warnf("webhook closed, dropping %s event for node %s", event.Event, event.Node)
+		return
+	}
+	select {
+	case s.events <- event:
+	default:
+		log.Warnf("webhook queue full, dropping %s event for node %s", event.Event, event.Node)
+	}
+}
+
+// Close sends the queued events until the context is done, then drops the remaining ones
+func (s *Sink) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		<-s.done
+		return fmt.Errorf("webhook events dropped: %w", ctx.Err())
+	}
+}
+
+func (s *Sink) run() {
+	defer close(s.done)
+	defer s.cancel()
+
+	for event := range s.events {
+		if s.ctx.Err() != nil {
+			continue
+		}
+		if err := s.send(s.ctx, event); err != nil {
+			log.WithError(err).Errorf("failed to send %s event for node %s to the webhook", event.Event, event.Node)
+		}
+	}
+}
+
+// body renders the body of the event
+func (s *Sink) body(event Event) ([]byte, error) {
+	if s.template == nil {
+		return json.Marshal(event)
+	}
+	var body bytes.Buffer
+	if err := s.template.Execute(&body, event); err != nil {
+		return nil, err
+	}
+	return body.Bytes(), nil
+}
+
+// send posts the event, retrying with exponential backoff
+func (s *Sink) send(ctx context.Context, event Event) error {
+	body, err := s.body(event)
+	if err != nil {
+		return err
+	}
+
+	delay := s.config.RetryDelay
+	for attempt := 0; ; attempt++ {
+		err = s.post(ctx, body)
+		if err == nil || attempt >= s.config.Retries {
+			return err
+		}
+		log.WithError(err).Warnf("webhook request failed, retrying in %s", delay)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (s *Sink) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if s.config.SecretFile != "" {
+		secret, err := os.ReadFile(s.config.SecretFile)
+		if err != nil {
+			return err
+		}
+		mac := hmac.New(sha256.New, []byte(strings.TrimSpace(string(secret))))
+		mac.Write(body)
+		req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookServer records the bodies and signatures it receives, failing the first requests
+type webhookServer struct {
+	mu         sync.Mutex
+	failures   int
+	bodies     []string
+	signatures []string
+}
+
+func (w *webhookServer) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	if w.failures > 0 {
+		w.failures--
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.bodies = append(w.bodies, string(body))
+	w.signatures = append(w.signatures, r.Header.Get(SignatureHeader))
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func sign(t *testing.T, secret string, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, err := mac.Write([]byte(body))
+	require.NoError(t, err)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestSink(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(secretFile, []byte("s3cr3t\n"), 0o600))
+	server := &webhookServer{failures: 2}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	sink, err := New(Config{URL: httpServer.URL, SecretFile: secretFile, Retries: 2, RetryDelay: time.Millisecond})
+	require.NoError(t, err)
+
+	event := Event{
+		Event:      EventCreated,
+		Cluster:    "test",
+		Target:     "alertmanager",
+		Node:       "kind-worker",
+		Matchers:   []string{`{instance="kind-worker"}`},
+		StartsAt:   time.Date(2024, time.May, 31, 6, 31, 0, 0, time.UTC),
+		EndsAt:     time.Date(2024, time.May, 31, 7, 31, 0, 0, time.UTC),
+		SilenceIDs: []string{"00000000-0000-0000-0000-000000000001"},
+		Time:       time.Date(2024, time.May, 31, 6, 31, 0, 0, time.UTC),
+	}
+	sink.Notify(event)
+	require.NoError(t, sink.Close(context.Background()))
+
+	// the event is sent once the webhook recovers
+	require.Len(t, server.bodies, 1)
+	decoded := Event{}
+	require.NoError(t, json.Unmarshal([]byte(server.bodies[0]), &decoded))
+	assert.Equal(t, event, decoded)
+	assert.Equal(t, sign(t, "s3cr3t", server.bodies[0]), server.signatures[0])
+
+	// events are dropped once closed
+	sink.Notify(event)
+	assert.Len(t, server.bodies, 1)
+}
+
+func TestSinkBodyTemplate(t *testing.T) {
+	server := &webhookServer{failures: 1}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	sink, err := New(Config{
+		URL:          httpServer.URL,
+		BodyTemplate: `{"text": {{printf "%s silences for node %s on %s: %v" .Event .Node .Cluster .Matchers | json}}}`,
+	})
+	require.NoError(t, err)
+
+	sink.Notify(Event{Event: EventExtended, Cluster: "test", Node: "kind-worker", Matchers: []string{`{instance="kind-worker"}`}})
+	sink.Notify(Event{Event: EventFailed, Cluster: "test", Node: "kind-worker2"})
+	require.NoError(t, sink.Close(context.Background()))
+
+	// without retries the first event is lost
+	assert.Equal(t, []string{`{"text": "failed silences for node kind-worker2 on test: []"}`}, server.bodies)
+	assert.Equal(t, []string{""}, server.signatures)
+
+	_, err = New(Config{URL: httpServer.URL, BodyTemplate: "{{.Event"})
+	assert.Error(t, err)
+	_, err = New(Config{})
+	assert.Error(t, err)
+}
+
+func TestSinkCloseTimeout(t *testing.T) {
+	server := &webhookServer{failures: 100}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	sink, err := New(Config{URL: httpServer.URL, Retries: 10, RetryDelay: time.Hour})
+	require.NoError(t, err)
+	sink.Notify(Event{Event: EventCreated})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Error(t, sink.Close(ctx))
+}